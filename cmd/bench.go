@@ -10,6 +10,7 @@ import (
 
 	"github.com/electr1fy0/sorta/internal/bench"
 	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/hash"
 	"github.com/spf13/cobra"
 )
 
@@ -33,7 +34,14 @@ var benchCmd = &cobra.Command{
 			fmt.Fprintf(os.Stderr, "\r[%s] %d/%d", event.Stage, event.Completed, event.Total)
 		}
 
-		report, err := bench.BenchmarkDuplicatesCtx(ctx, dir, progress)
+		algo := hash.DefaultAlgorithm
+		if benchHash != "" {
+			if algo, err = hash.ParseAlgorithm(benchHash); err != nil {
+				return err
+			}
+		}
+
+		report, err := bench.BenchmarkDuplicatesCtx(ctx, dir, algo, progress)
 		if err != nil {
 			return fmt.Errorf("benchmark failed: %w", err)
 		}
@@ -44,7 +52,7 @@ var benchCmd = &cobra.Command{
 			mbps = (float64(report.Stats.BytesHashed) / 1024.0 / 1024.0) / report.Stats.DecideDuration.Seconds()
 		}
 
-		fmt.Printf("Benchmark: duplicates (%s)\n", report.Directory)
+		fmt.Printf("Benchmark: duplicates (%s, %s)\n", report.Directory, report.Algorithm)
 		fmt.Printf("- files scanned: %d\n", report.Files)
 		fmt.Printf("- planned operations: %d (%d dedupes)\n", report.Ops, report.Dedupes)
 		fmt.Printf("- walk time: %s\n", report.Stats.WalkDuration)
@@ -57,10 +65,18 @@ var benchCmd = &cobra.Command{
 		fmt.Printf("- bytes hashed: %s\n", core.HumanReadable(report.Stats.BytesHashed))
 		fmt.Printf("- hash throughput: %.2f MiB/s\n", mbps)
 
+		fmt.Println("\nHash algorithms (CPU time only):")
+		for _, r := range report.Algorithms {
+			fmt.Printf("- %-7s %10.2f MiB/s  %s for %s\n", r.Algorithm, r.Throughput(), r.Duration, core.HumanReadable(r.Bytes))
+		}
+
 		return nil
 	},
 }
 
+var benchHash string
+
 func init() {
+	benchCmd.Flags().StringVar(&benchHash, "hash", "", "Hash used for the duplicate scan: xxh64, sha256 or sha1 (default: xxh64)")
 	rootCmd.AddCommand(benchCmd)
 }
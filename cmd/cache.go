@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/hash"
+	"github.com/electr1fy0/sorta/internal/journal"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and maintain the duplicate hash cache",
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:     "stats",
+	Short:   "Show the size and contents of the hash cache",
+	Aliases: []string{"info"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := hash.LoadHashCache()
+		if err != nil {
+			return err
+		}
+		stats := cache.Stats()
+
+		fmt.Printf("Hash cache: %s\n", stats.Path)
+		fmt.Printf("- entries: %d\n", stats.Entries)
+		fmt.Printf("- log records: %d\n", stats.Records)
+		fmt.Printf("- size on disk: %s\n", core.HumanReadable(stats.Bytes))
+		names := make([]string, 0, len(stats.ByAlgorithm))
+		for name := range stats.ByAlgorithm {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("- %s hashes: %d\n", name, stats.ByAlgorithm[name])
+		}
+		fmt.Printf("- image hashes: %d\n", stats.Images)
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Drop entries for files that are gone or have changed",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := hash.LoadHashCache()
+		if err != nil {
+			return err
+		}
+		before := cache.Stats()
+		removed, err := cache.Prune()
+		if err != nil {
+			return fmt.Errorf("failed to prune hash cache: %w", err)
+		}
+		after := cache.Stats()
+
+		fmt.Printf("Pruned %d of %d entries (%s -> %s)\n", removed, before.Entries,
+			core.HumanReadable(before.Bytes), core.HumanReadable(after.Bytes))
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:     "clear",
+	Short:   "Delete the hash cache",
+	Aliases: []string{"reset"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := hash.ClearHashCache(); err != nil {
+			return fmt.Errorf("failed to clear hash cache: %w", err)
+		}
+		fmt.Println("Hash cache cleared.")
+		return nil
+	},
+}
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Rehash cached files and check the cache for damage",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := hash.RecoverHashCache()
+		var corrupt *journal.CorruptError
+		if err != nil && !errors.As(err, &corrupt) {
+			return err
+		}
+		if corrupt != nil {
+			fmt.Printf("Corrupt: %v\n", corrupt)
+		}
+
+		res := cache.Verify(func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\r[verify] %d/%d", done, total)
+		})
+		fmt.Fprintln(os.Stderr)
+
+		for _, path := range res.Mismatched {
+			fmt.Printf("Mismatch: %s\n", path)
+		}
+		fmt.Printf("Checked %d entries: %d mismatched, %d stale\n", res.Checked, len(res.Mismatched), len(res.Stale))
+		if len(res.Stale) > 0 {
+			fmt.Println("Run 'sorta cache prune' to drop stale entries.")
+		}
+
+		if err := cache.Save(); err != nil {
+			return fmt.Errorf("failed to save hash cache: %w", err)
+		}
+		if corrupt != nil || len(res.Mismatched) > 0 {
+			fmt.Println("Damaged and mismatched entries have been removed.")
+			bad := 0
+			if corrupt != nil {
+				bad = len(corrupt.Lines)
+			}
+			return fmt.Errorf("hash cache had %d corrupt records and %d mismatched entries", bad, len(res.Mismatched))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheStatsCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cacheVerifyCmd)
+}
@@ -7,10 +7,12 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 
 	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/hash"
 	"github.com/electr1fy0/sorta/internal/ignore"
 	"github.com/electr1fy0/sorta/internal/ops"
 	"github.com/electr1fy0/sorta/internal/tui"
@@ -22,6 +24,22 @@ const (
 	ansiCyan  = "[36m"
 )
 
+// warned holds the directories already warned about unfinished
+// transactions.
+var warned = make(map[string]bool)
+
+// warnUnfinished warns once about each of dirs that holds a transaction
+// interrupted before it completed.
+func warnUnfinished(dirs ...string) {
+	for _, dir := range dirs {
+		if warned[dir] {
+			continue
+		}
+		warned[dir] = true
+		fmt.Fprintf(os.Stderr, "warning: unfinished transaction in %s (run 'sorta recover %s')\n", dir, dir)
+	}
+}
+
 func resolvePath(path string) (string, error) {
 	var err error
 	path, err = core.ExpandPath(path)
@@ -58,8 +76,48 @@ func validateDir(path string) (string, error) {
 	return path, nil
 }
 
-func runSort(dir string, sorter core.Sorter, ignorePatterns []string) error {
+// scanDir collects the files below dir that the ignore rules and
+// excluded directories let through.
+func scanDir(ctx context.Context, dir string, ignorePatterns []string, exclude ...string) ([]core.FileEntry, error) {
+	ignoreMatcher, err := ignore.LoadIgnoreMatcher(dir, ignorePatterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ignore patterns: %w", err)
+	}
+	for _, ex := range exclude {
+		ignoreMatcher.ExcludeDir(ex)
+	}
+
+	var files []core.FileEntry
+	err = ops.WalkFilesWithIgnoreCtx(ctx, dir, ignoreMatcher, func(file core.FileEntry) error {
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan directory: %w", err)
+	}
+	return files, nil
+}
+
+// loadHashCache returns the hash cache so moves can update it, or nil if it
+// can't be used.
+func loadHashCache() *hash.HashCache {
+	cache, err := hash.LoadHashCache()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hash cache disabled: %v\n", err)
+		return nil
+	}
+	return cache
+}
+
+func runSort(dir string, sorter core.Sorter, ignorePatterns []string, destRoot string) error {
+	if destRoot == dir {
+		destRoot = ""
+	}
+
 	fmt.Printf("%sDir:%s %s\n", ansiCyan, ansiReset, dir)
+	if destRoot != "" {
+		fmt.Printf("%sDest:%s %s\n", ansiCyan, ansiReset, destRoot)
+	}
 	fmt.Println("Analyzing files...")
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
@@ -68,6 +126,9 @@ func runSort(dir string, sorter core.Sorter, ignorePatterns []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load ignore patterns: %w", err)
 	}
+	if destRoot != "" {
+		ignoreMatcher.ExcludeDir(destRoot)
+	}
 
 	plannedOps, err := ops.PlanOperationsWithIgnoreCtx(ctx, dir, sorter, ignoreMatcher)
 	if err != nil {
@@ -87,19 +148,34 @@ func runSort(dir string, sorter core.Sorter, ignorePatterns []string) error {
 		return nil
 	}
 
-	moves, deletes, skips, renames, dedupes := 0, 0, 0, 0, 0
+	moves, deletes, skips, renames, dedupes, copies, links, relinks, conflicts := 0, 0, 0, 0, 0, 0, 0, 0, 0
+	var reclaimable int64
 	for _, op := range cleanedOps {
+		if op.Resolution != core.ResolveNone {
+			conflicts++
+		}
 		switch op.OpType {
 		case core.OpMove:
 			moves++
 		case core.OpDelete:
 			deletes++
 		case core.OpSkip:
-			skips++
+			if op.Resolution == core.ResolveNone {
+				skips++
+			}
 		case core.OpRename:
 			renames++
 		case core.OpDedupe:
 			dedupes++
+		case core.OpCopy:
+			copies++
+		case core.OpSymlink, core.OpHardlink:
+			links++
+		case core.OpRelinkHard, core.OpRelinkReflink:
+			relinks++
+			if ops.LinkCount(op.File.SourcePath) == 1 {
+				reclaimable += op.Size
+			}
 		}
 	}
 
@@ -107,6 +183,12 @@ func runSort(dir string, sorter core.Sorter, ignorePatterns []string) error {
 	if moves > 0 {
 		fmt.Printf("- %d files to move\n", moves)
 	}
+	if copies > 0 {
+		fmt.Printf("- %d files to copy\n", copies)
+	}
+	if links > 0 {
+		fmt.Printf("- %d links to create\n", links)
+	}
 	if deletes > 0 {
 		fmt.Printf("- %d files to delete\n", deletes)
 	}
@@ -116,9 +198,15 @@ func runSort(dir string, sorter core.Sorter, ignorePatterns []string) error {
 	if dedupes > 0 {
 		fmt.Printf("- %d files to deduplicate\n", dedupes)
 	}
+	if relinks > 0 {
+		fmt.Printf("- %d duplicates to replace with links (%s reclaimable)\n", relinks, core.HumanReadable(reclaimable))
+	}
 	if skips > 0 {
 		fmt.Printf("- %d files skipped (no match)\n", skips)
 	}
+	if conflicts > 0 {
+		fmt.Printf("- %d destination conflicts resolved\n", conflicts)
+	}
 
 	if dryRun {
 		fmt.Println("\nDry run complete. No changes made.")
@@ -128,7 +216,7 @@ func runSort(dir string, sorter core.Sorter, ignorePatterns []string) error {
 	if isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()) {
 		var tuiOps []core.FileOperation
 		for _, op := range cleanedOps {
-			if op.OpType != core.OpSkip {
+			if op.OpType != core.OpSkip || op.Resolution != core.ResolveNone {
 				tuiOps = append(tuiOps, op)
 			}
 		}
@@ -137,6 +225,8 @@ func runSort(dir string, sorter core.Sorter, ignorePatterns []string) error {
 			fmt.Println("No changes to make.")
 			return nil
 		}
+		// Keep each duplicate group together in the review list.
+		sort.SliceStable(tuiOps, func(i, j int) bool { return tuiOps[i].Keeper < tuiOps[j].Keeper })
 
 		selectedOps, err := tui.SelectOperations(dir, tuiOps)
 		if err != nil {
@@ -160,6 +250,8 @@ func runSort(dir string, sorter core.Sorter, ignorePatterns []string) error {
 
 	executor := &ops.Executor{
 		Operations: make([]core.FileOperation, 0),
+		DestRoot:   destRoot,
+		Cache:      loadHashCache(),
 	}
 	reporter := &ops.Reporter{}
 
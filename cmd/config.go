@@ -113,19 +113,15 @@ var configListCmd = &cobra.Command{
 			return err
 		}
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 4, ' ', 0)
-		fmt.Fprintln(w, "FOLDER\tMATCHERS")
-		fmt.Fprintln(w, "------\t--------")
+		fmt.Fprintln(w, "FOLDER\tMATCHERS\tOPTIONS")
+		fmt.Fprintln(w, "------\t--------\t-------")
 
 		for i, folder := range cfg.Foldernames {
 			var matchers []string
 			for _, m := range cfg.Matchers[i] {
-				if m.Regex != nil {
-					matchers = append(matchers, fmt.Sprintf("regex(%s)", m.Regex.String()))
-				} else {
-					matchers = append(matchers, m.Raw)
-				}
+				matchers = append(matchers, m.String())
 			}
-			fmt.Fprintf(w, "%s\t%s\n", folder, strings.Join(matchers, ", "))
+			fmt.Fprintf(w, "%s\t%s\t%s\n", folder, strings.Join(matchers, ", "), cfg.OptionsFor(i))
 		}
 
 		if len(cfg.Blacklist) > 0 {
@@ -135,6 +131,18 @@ var configListCmd = &cobra.Command{
 				fmt.Fprintln(w, b)
 			}
 		}
+		if len(cfg.Keep) > 0 {
+			fmt.Fprintln(w, "\nDUPLICATE KEEP PRIORITY")
+			fmt.Fprintln(w, "-----------------------")
+			for _, k := range cfg.Keep {
+				fmt.Fprintln(w, k)
+			}
+		}
+		if cfg.Hash != "" {
+			fmt.Fprintln(w, "\nDUPLICATE HASH")
+			fmt.Fprintln(w, "--------------")
+			fmt.Fprintln(w, cfg.Hash)
+		}
 		if len(cfg.Warnings) > 0 {
 			fmt.Fprintln(w, "\nWARNINGS")
 			fmt.Fprintln(w, "--------")
@@ -1,28 +1,241 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/electr1fy0/sorta/internal/config"
+	"github.com/electr1fy0/sorta/internal/core"
 	"github.com/electr1fy0/sorta/internal/dupl"
+	"github.com/electr1fy0/sorta/internal/hash"
+	"github.com/electr1fy0/sorta/internal/ignore"
 	"github.com/electr1fy0/sorta/internal/ops"
 	"github.com/spf13/cobra"
 )
 
 var duplCmd = &cobra.Command{
-	Use:     "duplicates <directory>",
+	Use:     "duplicates <directory> [report file]",
 	Short:   "Filter out duplicate files",
-	Args:    cobra.MaximumNArgs(1),
+	Args:    cobra.MaximumNArgs(2),
 	Aliases: []string{"dupl", "dedupe", "dd"},
 
 	RunE: func(cmd *cobra.Command, args []string) error {
+		// With --report, the file to write can follow the directory.
+		out := reportOut
+		if len(args) == 2 {
+			if reportFormat == "" {
+				return fmt.Errorf("a report file can only be given with --report")
+			}
+			if out != "" {
+				return fmt.Errorf("give the report file either as an argument or with --out, not both")
+			}
+			args, out = args[:1], args[1]
+		}
+		if reportFormat != "" && reportFormat != "json" && reportFormat != "csv" {
+			return fmt.Errorf("unknown report format %q (use json or csv)", reportFormat)
+		}
+
 		dir, err := getDir(args)
 		if err != nil {
 			return err
 		}
-
-		return runSort(dir, dupl.NewDuplicateFinder(), nil)
+		if ops.PermanentDelete && !ops.DuplNuke {
+			return fmt.Errorf("--permanent only applies with --nuke")
+		}
+		if linkMode != "" && ops.DuplNuke {
+			return fmt.Errorf("--link and --nuke cannot be used together")
+		}
+		if dirMode && (similarImages || linkMode != "" || len(againstDirs) > 0) {
+			return fmt.Errorf("--dirs cannot be combined with --similar-images, --link or --against")
+		}
+		if ops.DuplVerify && similarImages {
+			return fmt.Errorf("--verify cannot be used with --similar-images: similar images are not identical")
+		}
+		if ops.DuplNuke && similarImages {
+			return fmt.Errorf("--nuke cannot be used with --similar-images: similar images are not identical")
+		}
+		if linkMode != "" && similarImages {
+			return fmt.Errorf("--link cannot be used with --similar-images: similar images are not identical")
+		}
+		finder, err := newDuplicateFinder(dir)
+		if err != nil {
+			return err
+		}
+		if err := finder.SetLinkMode(linkMode); err != nil {
+			return err
+		}
+		if similarImages {
+			finder.SetSimilarImages(maxDistance)
+		}
+		finder.SetDirectories(dirMode)
+		for _, ref := range againstDirs {
+			if err := addReference(finder, dir, ref); err != nil {
+				return err
+			}
+		}
+		if reportFormat != "" {
+			return writeDuplicateReport(dir, out, finder)
+		}
+		return runSort(dir, finder, nil, "")
 	},
 }
 
+// newDuplicateFinder sets up a DuplicateFinder with the keep policy from
+// --keep and any @keep priority list in the config, hashing with --hash or
+// the config's @hash line.
+func newDuplicateFinder(dir string) (*dupl.DuplicateFinder, error) {
+	policy, err := dupl.ParseKeepPolicy(keepPolicy)
+	if err != nil {
+		return nil, err
+	}
+	algo := hash.DefaultAlgorithm
+	if hashAlgo != "" {
+		if algo, err = hash.ParseAlgorithm(hashAlgo); err != nil {
+			return nil, err
+		}
+	}
+
+	path := configPath
+	if path != "" {
+		if path, err = resolvePath(path); err != nil {
+			return nil, err
+		}
+	}
+	cfg, err := config.ReadSettings(path, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config warning: keep priorities not loaded: %v\n", err)
+	} else {
+		for _, warning := range cfg.Warnings {
+			fmt.Fprintf(os.Stderr, "config warning: %s\n", warning)
+		}
+		policy.AddPriority(cfg.Keep)
+		if hashAlgo == "" && cfg.Hash != "" {
+			algo, _ = hash.ParseAlgorithm(cfg.Hash)
+		}
+	}
+
+	finder := dupl.NewDuplicateFinder()
+	finder.SetKeepPolicy(policy)
+	finder.SetAlgorithm(algo)
+	return finder, nil
+}
+
+// writeDuplicateReport finds the duplicate groups in dir and writes them to
+// out, or stdout, without planning or applying anything. The summary of a
+// CSV report goes to a .summary.csv file next to it, or to stderr.
+func writeDuplicateReport(dir, out string, finder *dupl.DuplicateFinder) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	files, err := scanDir(ctx, dir, nil)
+	if err != nil {
+		return err
+	}
+	groups, err := finder.Groups(ctx, files)
+	if err != nil {
+		return fmt.Errorf("failed to find duplicates: %w", err)
+	}
+	algo, stats := finder.Algorithm(), finder.Stats()
+
+	if out == "" || out == "-" {
+		if err := dupl.WriteReport(os.Stdout, reportFormat, dir, algo, groups, stats); err != nil {
+			return err
+		}
+		if reportFormat == "csv" {
+			return dupl.WriteSummaryCSV(os.Stderr, dir, algo, groups, stats)
+		}
+		return nil
+	}
+	out, err = resolvePath(out)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := dupl.WriteReport(&buf, reportFormat, dir, algo, groups, stats); err != nil {
+		return err
+	}
+	if err := core.WriteFileAtomic(out, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	fmt.Printf("Wrote %d duplicate groups to %s\n", len(groups), out)
+
+	if reportFormat == "csv" {
+		summary := strings.TrimSuffix(out, filepath.Ext(out)) + ".summary.csv"
+		buf.Reset()
+		if err := dupl.WriteSummaryCSV(&buf, dir, algo, groups, stats); err != nil {
+			return err
+		}
+		if err := core.WriteFileAtomic(summary, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write report summary: %w", err)
+		}
+		fmt.Printf("Wrote the summary to %s\n", summary)
+	}
+	return nil
+}
+
+// addReference walks the reference tree ref and hands its files to finder.
+// The scanned directory is left out if it sits inside ref.
+func addReference(finder *dupl.DuplicateFinder, dir, ref string) error {
+	ref, err := validateDir(ref)
+	if err != nil {
+		return fmt.Errorf("invalid reference directory: %w", err)
+	}
+	if ref == dir {
+		return fmt.Errorf("reference directory must differ from %s", dir)
+	}
+
+	ignoreMatcher, err := ignore.LoadIgnoreMatcher(ref, nil)
+	if err != nil {
+		return fmt.Errorf("failed to load ignore patterns for %s: %w", ref, err)
+	}
+	if rel, err := filepath.Rel(ref, dir); err == nil && !strings.HasPrefix(rel, "..") {
+		ignoreMatcher.ExcludeDir(dir)
+	}
+
+	var files []core.FileEntry
+	err = ops.WalkFilesWithIgnore(ref, ignoreMatcher, func(file core.FileEntry) error {
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan reference directory: %w", err)
+	}
+
+	fmt.Printf("%sReference:%s %s (%d files)\n", ansiCyan, ansiReset, ref, len(files))
+	finder.AddReferences(files)
+	return nil
+}
+
+var (
+	keepPolicy    string
+	linkMode      string
+	againstDirs   []string
+	similarImages bool
+	maxDistance   int
+	reportFormat  string
+	reportOut     string
+	hashAlgo      string
+	dirMode       bool
+)
+
 func init() {
-	duplCmd.PersistentFlags().BoolVar(&ops.DuplNuke, "nuke", false, "Delete duplicates permanently")
+	duplCmd.PersistentFlags().BoolVar(&ops.DuplNuke, "nuke", false, "Move duplicates to the trash instead of the duplicates folder")
+	duplCmd.PersistentFlags().BoolVar(&ops.PermanentDelete, "permanent", false, "With --nuke, delete duplicates for good instead of trashing them (cannot be undone)")
+	duplCmd.PersistentFlags().BoolVar(&ops.DuplVerify, "verify", false, "Compare each duplicate with the kept copy byte for byte before acting on it")
+	duplCmd.PersistentFlags().StringVar(&keepPolicy, "keep", "oldest", "Which copy to keep: oldest, newest, shortest-path, longest-name or in=<dir>")
+	duplCmd.PersistentFlags().StringVar(&linkMode, "link", "", "Replace duplicates in place with links to the kept copy: hard or reflink")
+	duplCmd.PersistentFlags().StringSliceVar(&againstDirs, "against", nil, "Only flag files whose content already exists in this reference directory (repeatable)")
+	duplCmd.PersistentFlags().BoolVar(&dirMode, "dirs", false, "Find whole folders that are identical to, or contained in, another folder")
+	duplCmd.PersistentFlags().BoolVar(&similarImages, "similar-images", false, "Find resized or re-encoded copies of JPEG, PNG and GIF images")
+	duplCmd.PersistentFlags().IntVar(&maxDistance, "max-distance", 10, "With --similar-images, how many of the 64 hash bits may differ")
+	duplCmd.PersistentFlags().StringVar(&reportFormat, "report", "", "Write the duplicate groups as json or csv instead of moving anything")
+	duplCmd.PersistentFlags().StringVar(&reportOut, "out", "", "With --report, the file to write, same as the second argument (default: stdout)")
+	duplCmd.PersistentFlags().StringVar(&hashAlgo, "hash", "", "Hash used to compare contents: xxh64, sha256 or sha1 (default: config, then xxh64)")
 	rootCmd.AddCommand(duplCmd)
 }
@@ -33,13 +33,10 @@ var historyCmd = &cobra.Command{
 		}
 		if oneline {
 			for _, t := range transactions {
-				typeStr := "action"
-				if t.TType == core.TUndo {
-					typeStr = "undo"
-				}
-				rootDir := ""
-				if len(t.Operations) > 0 {
-					rootDir = t.Operations[0].File.RootDir
+				typeStr := strings.ToLower(transactionType(t))
+				rootDir := t.RootDir()
+				if t.DestRoot != "" {
+					rootDir += " -> " + t.DestRoot
 				}
 				id := strings.ReplaceAll(t.ID, " ", "_")
 				fmt.Printf("%s %s %d %s\n", id, typeStr, len(t.Operations), rootDir)
@@ -48,17 +45,17 @@ var historyCmd = &cobra.Command{
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "ID\tType\tFiles Affected\tRoot Directory")
+		fmt.Fprintln(w, "ID\tType\tFiles Affected\tRoot Directory\tReverts")
 		for _, t := range transactions {
-			typeStr := "Action"
-			if t.TType == core.TUndo {
-				typeStr = "Undo"
+			rootDir := t.RootDir()
+			if t.DestRoot != "" {
+				rootDir += " -> " + t.DestRoot
 			}
-			rootDir := ""
-			if len(t.Operations) > 0 {
-				rootDir = t.Operations[0].File.RootDir
+			reverts := t.Reverts
+			if reverts == "" {
+				reverts = "-"
 			}
-			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", t.ID, typeStr, len(t.Operations), rootDir)
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", t.ID, transactionType(t), len(t.Operations), rootDir, reverts)
 		}
 		w.Flush()
 
@@ -66,6 +63,16 @@ var historyCmd = &cobra.Command{
 	},
 }
 
+func transactionType(t core.Transaction) string {
+	switch t.TType {
+	case core.TUndo:
+		return "Undo"
+	case core.TRedo:
+		return "Redo"
+	}
+	return "Action"
+}
+
 func init() {
 	historyCmd.Flags().Bool("oneline", false, "Show compact history output")
 	rootCmd.AddCommand(historyCmd)
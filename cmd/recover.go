@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/electr1fy0/sorta/internal/ops"
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover <directory>",
+	Short: "Roll back or finish operations that were interrupted",
+	Long:  "Finds transactions in a directory that never completed, for example because sorta was killed or the machine lost power. A transaction already recorded in the history is finished; any other is rolled back from its intent log, putting every file back where it was.",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := validateDir(args[0])
+		if err != nil {
+			return err
+		}
+
+		recoveries := ops.Recover(dir)
+		if len(recoveries) == 0 {
+			fmt.Printf("No unfinished transactions in %s\n", dir)
+			return nil
+		}
+
+		var failed int
+		for _, r := range recoveries {
+			name := r.ID
+			if name == "" {
+				name = r.Dir
+			}
+			switch {
+			case r.Err != nil:
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, r.Err)
+				failed++
+			case r.Finished:
+				fmt.Printf("Finished %s (it was already recorded in history)\n", name)
+			default:
+				fmt.Printf("Rolled back %s (%d steps)\n", name, r.RolledBack)
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to recover %d of %d transactions", failed, len(recoveries))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recoverCmd)
+}
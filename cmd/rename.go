@@ -15,7 +15,7 @@ var renameCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		return runSort(dir, rename.NewRenamer(), nil)
+		return runSort(dir, rename.NewRenamer(), nil, "")
 	},
 }
 
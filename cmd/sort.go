@@ -6,6 +6,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/electr1fy0/sorta/internal/ops"
 	"github.com/electr1fy0/sorta/internal/sorter"
 	"github.com/spf13/cobra"
 )
@@ -23,7 +24,14 @@ func getDir(args []string) (string, error) {
 	} else {
 		dirLine = args[0]
 	}
-	return validateDir(strings.TrimSpace(dirLine))
+	dir, err := validateDir(strings.TrimSpace(dirLine))
+	if err != nil {
+		return "", err
+	}
+	if len(ops.LeftoverTransactions(dir)) > 0 {
+		warnUnfinished(dir)
+	}
+	return dir, nil
 }
 
 var sortCmd = &cobra.Command{
@@ -37,25 +45,52 @@ var sortCmd = &cobra.Command{
 			return err
 		}
 
-		if configPath != "" {
-			configPath, err = resolvePath(configPath)
-			if err != nil {
-				return err
-			}
+		configSorter, destRoot, err := newConfigSorter(dir)
+		if err != nil {
+			return err
 		}
 
-		configSorter, err := sorter.NewConfigSorter(dir, configPath, inline)
+		return runSort(dir, configSorter, configSorter.GetBlacklist(), destRoot)
+	},
+}
+
+// newConfigSorter loads the rules for dir and works out where sorted files
+// go, honoring --dest over any @root setting.
+func newConfigSorter(dir string) (*sorter.ConfigSorter, string, error) {
+	var err error
+	if configPath != "" {
+		configPath, err = resolvePath(configPath)
 		if err != nil {
-			return fmt.Errorf("error creating config sorter: %w", err)
+			return nil, "", err
 		}
+	}
 
-		return runSort(dir, configSorter, configSorter.GetBlacklist())
-	},
+	configSorter, err := sorter.NewConfigSorter(dir, configPath, inline)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating config sorter: %w", err)
+	}
+
+	if destDir != "" {
+		configSorter.SetDestRoot(destDir)
+	}
+	destRoot := configSorter.DestRoot()
+	if destRoot != "" {
+		destRoot, err = validateDir(destRoot)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid destination: %w", err)
+		}
+		configSorter.SetDestRoot(destRoot)
+	}
+	return configSorter, destRoot, nil
 }
 
-var inline string
+var (
+	inline  string
+	destDir string
+)
 
 func init() {
 	rootCmd.AddCommand(sortCmd)
 	sortCmd.PersistentFlags().StringVar(&inline, "inline", "", "Skip the config and read a single line from the flag's value")
+	sortCmd.PersistentFlags().StringVar(&destDir, "dest", "", "Sort files into this directory instead of the scanned one")
 }
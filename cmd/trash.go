@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/electr1fy0/sorta/internal/ops"
+	"github.com/electr1fy0/sorta/internal/trash"
+	"github.com/spf13/cobra"
+)
+
+var trashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore or empty trashed files",
+	Long:  "Files deleted by sorta go to the desktop trash (~/.local/share/Trash, or .Trash-$uid at the top of another filesystem), where file managers can see them too. Only the files sorta trashed are listed, restored or emptied, unless --all is given.",
+}
+
+var trashAll bool
+
+// trashItems returns the trashed files sorta's history says it put in the
+// trash, oldest first, or with --all everything in the trash.
+func trashItems() ([]trash.Item, error) {
+	items, err := trash.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trash: %w", err)
+	}
+	if trashAll {
+		return items, nil
+	}
+	trashed, err := ops.TrashedPaths()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	var own []trash.Item
+	for _, item := range items {
+		if trashed[item.Path()] {
+			own = append(own, item)
+		}
+	}
+	return own, nil
+}
+
+var trashListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List trashed files",
+	Aliases: []string{"ls"},
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		items, err := trashItems()
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			fmt.Println("No trashed files.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Deleted\tName\tOriginal Path")
+		for _, item := range items {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", item.DeletedAt.Format("2006-01-02 15:04:05"), item.Name, item.OriginalPath)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+var trashRestoreCmd = &cobra.Command{
+	Use:   "restore <original path or name>...",
+	Short: "Put trashed files back where they were",
+	Long:  "Restores each file, given by the path it was deleted from or its name in the trash. If several trashed files match, the most recently deleted one is restored.",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		items, err := trashItems()
+		if err != nil {
+			return err
+		}
+
+		var failed int
+		for _, arg := range args {
+			path, err := resolvePath(arg)
+			if err != nil {
+				return err
+			}
+			// items is oldest first, so the last match is the newest.
+			var match *trash.Item
+			for i := range items {
+				if items[i].OriginalPath == path || items[i].Name == arg {
+					match = &items[i]
+				}
+			}
+			if match == nil {
+				fmt.Fprintf(os.Stderr, "%s: not found in the trash\n", arg)
+				failed++
+				continue
+			}
+			if err := trash.Restore(*match, ""); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", arg, err)
+				failed++
+				continue
+			}
+			fmt.Printf("Restored %s\n", match.OriginalPath)
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to restore %d of %d files", failed, len(args))
+		}
+		return nil
+	},
+}
+
+var trashEmptyCmd = &cobra.Command{
+	Use:   "empty",
+	Short: "Permanently delete the files sorta trashed",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		items, err := trashItems()
+		if err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			fmt.Println("No trashed files to delete.")
+			return nil
+		}
+
+		fmt.Printf("Permanently delete %d trashed files? Operations that trashed them can no longer be undone. [y/N]: ", len(items))
+		reader := bufio.NewReader(os.Stdin)
+		ans, _ := reader.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(ans)) != "y" {
+			fmt.Println("Empty cancelled.")
+			return nil
+		}
+
+		var failed int
+		for _, item := range items {
+			if err := trash.Remove(item); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", filepath.Base(item.Path()), err)
+				failed++
+			}
+		}
+		fmt.Printf("Deleted %d files from the trash.\n", len(items)-failed)
+		if failed > 0 {
+			return fmt.Errorf("failed to delete %d trashed files", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	trashCmd.PersistentFlags().BoolVar(&trashAll, "all", false, "Include files other programs put in the trash")
+	rootCmd.AddCommand(trashCmd)
+	trashCmd.AddCommand(trashListCmd)
+	trashCmd.AddCommand(trashRestoreCmd)
+	trashCmd.AddCommand(trashEmptyCmd)
+}
@@ -2,15 +2,23 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/electr1fy0/sorta/internal/core"
 	"github.com/electr1fy0/sorta/internal/ops"
 	"github.com/spf13/cobra"
 )
 
+var (
+	undoID    string
+	undoSteps int
+	undoForce bool
+)
+
 var undoCmd = &cobra.Command{
 	Use:     "undo <directory>",
 	Short:   "Undo the last operation on a directory",
@@ -21,7 +29,21 @@ var undoCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Are you sure you want to undo the last operation in %s? [y/N]: ", dir)
+		if undoID != "" && undoSteps > 1 {
+			return fmt.Errorf("--id and --steps cannot be used together")
+		}
+		if undoSteps < 1 {
+			return fmt.Errorf("--steps must be at least 1")
+		}
+
+		what := "the last operation"
+		switch {
+		case undoID != "":
+			what = "operation " + undoID
+		case undoSteps > 1:
+			what = fmt.Sprintf("the last %d operations", undoSteps)
+		}
+		fmt.Printf("Are you sure you want to undo %s in %s? [y/N]: ", what, dir)
 		reader := bufio.NewReader(os.Stdin)
 		ans, _ := reader.ReadString('\n')
 		if strings.ToLower(strings.TrimSpace(ans)) != "y" {
@@ -29,23 +51,88 @@ var undoCmd = &cobra.Command{
 			return nil
 		}
 
-		if err := ops.Undo(dir); err != nil {
+		undone, res, err := ops.Undo(dir, ops.UndoOptions{ID: undoID, Steps: undoSteps, Force: undoForce})
+		for _, t := range undone {
+			fmt.Printf("Undid %s (%d operations)\n", t.ID, len(t.Operations))
+		}
+		if err != nil {
 			if errors.Is(err, ops.ErrAlreadyUndone) {
-				fmt.Printf("Last operation in %s already undone\n", dir)
+				if undoID != "" {
+					fmt.Printf("Operation %s was already undone\n", undoID)
+				} else {
+					fmt.Printf("Nothing left to undo in %s\n", dir)
+				}
 				return nil
 			}
 			if errors.Is(err, ops.ErrNoHistory) {
 				fmt.Printf("No recorded operations found for %s\n", dir)
 				return nil
 			}
+			if errors.Is(err, ops.ErrTouchedLater) {
+				return fmt.Errorf("%w (undo the later operation first, or use --force)", err)
+			}
+			if len(undone) > 0 || len(res.Errors) > 0 {
+				res.PrintSummary()
+			}
+			return err
+		}
+
+		if undoID == "" && len(undone) != undoSteps {
+			what = fmt.Sprintf("the last %d operations", len(undone))
+			if len(undone) == 1 {
+				what = "the last operation"
+			}
+		}
+		if len(res.Conflicts) > 0 {
+			fmt.Printf("Partly undid %s in: %s\n", what, dir)
+		} else {
+			fmt.Printf("Undid %s in: %s\n", what, dir)
+		}
+		res.PrintSummary()
+		return nil
+	},
+}
+
+var redoCmd = &cobra.Command{
+	Use:   "redo <directory>",
+	Short: "Apply the last undone operation on a directory again",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := getDir(args)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Are you sure you want to redo the last undone operation in %s? [y/N]: ", dir)
+		reader := bufio.NewReader(os.Stdin)
+		ans, _ := reader.ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(ans)) != "y" {
+			fmt.Println("Redo cancelled.")
+			return nil
+		}
+
+		executor := &ops.Executor{
+			Operations: make([]core.FileOperation, 0),
+			Cache:      loadHashCache(),
+		}
+		u, res, err := ops.Redo(context.Background(), dir, executor, &ops.Reporter{})
+		if err != nil {
+			if errors.Is(err, ops.ErrNothingToRedo) {
+				fmt.Printf("Nothing to redo in %s\n", dir)
+				return nil
+			}
 			return err
 		}
 
-		fmt.Printf("Undid last operation in: %s\n", dir)
+		fmt.Printf("Redid %s in: %s\n", u.Reverts, dir)
+		res.PrintSummary()
 		return nil
 	},
 }
 
 func init() {
+	undoCmd.Flags().StringVar(&undoID, "id", "", "Undo the transaction with this ID (see 'sorta history') instead of the last one")
+	undoCmd.Flags().IntVar(&undoSteps, "steps", 1, "Undo this many of the latest operations, newest first")
+	undoCmd.Flags().BoolVar(&undoForce, "force", false, "With --id, undo even if later operations touched the same files")
 	rootCmd.AddCommand(undoCmd)
+	rootCmd.AddCommand(redoCmd)
 }
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/ops"
+	"github.com/electr1fy0/sorta/internal/sorter"
+	"github.com/spf13/cobra"
+)
+
+var viewCmd = &cobra.Command{
+	Use:   "view <directory>",
+	Short: "Mirror the planned layout as a tree of symlinks without moving anything",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := getDir(args)
+		if err != nil {
+			return err
+		}
+		if viewOut == "" {
+			return fmt.Errorf("--out is required")
+		}
+		out, err := resolvePath(viewOut)
+		if err != nil {
+			return err
+		}
+		if out == dir {
+			return fmt.Errorf("view directory must differ from %s", dir)
+		}
+
+		var planner core.Sorter
+		var blacklist []string
+		destRoot := ""
+		if viewDuplicates {
+			planner, err = newDuplicateFinder(dir)
+			if err != nil {
+				return err
+			}
+		} else {
+			if configPath != "" {
+				configPath, err = resolvePath(configPath)
+				if err != nil {
+					return err
+				}
+			}
+			configSorter, err := sorter.NewConfigSorter(dir, configPath, inline)
+			if err != nil {
+				return fmt.Errorf("error creating config sorter: %w", err)
+			}
+			planner = configSorter
+			blacklist = configSorter.GetBlacklist()
+			destRoot = configSorter.DestRoot()
+		}
+
+		return runView(dir, out, planner, blacklist, destRoot)
+	},
+}
+
+func runView(dir, out string, planner core.Sorter, ignorePatterns []string, destRoot string) error {
+	fmt.Printf("%sDir:%s %s\n", ansiCyan, ansiReset, dir)
+	fmt.Printf("%sView:%s %s\n", ansiCyan, ansiReset, out)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	files, err := scanDir(ctx, dir, ignorePatterns, out)
+	if err != nil {
+		return err
+	}
+
+	plannedOps, err := ops.PlanFilesCtx(ctx, files, planner)
+	if err != nil {
+		return fmt.Errorf("failed to plan operations: %w", err)
+	}
+
+	links := ops.PlanView(dir, destRoot, files, plannedOps)
+	result, err := ops.SyncView(out, dir, links, dryRun)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Println("Dry run: the view was not changed.")
+	}
+	fmt.Printf("- %d links added\n", result.Added)
+	fmt.Printf("- %d stale links removed\n", result.Removed)
+	fmt.Printf("- %d links unchanged\n", result.Kept)
+	for _, err := range result.Errors {
+		fmt.Printf("  error: %v\n", err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("%d links could not be updated", len(result.Errors))
+	}
+	return nil
+}
+
+var (
+	viewOut        string
+	viewDuplicates bool
+)
+
+func init() {
+	rootCmd.AddCommand(viewCmd)
+	viewCmd.Flags().StringVar(&viewOut, "out", "", "Directory to build the symlink view in")
+	viewCmd.Flags().BoolVar(&viewDuplicates, "duplicates", false, "Lay out the duplicates plan instead of the sort config")
+	viewCmd.Flags().StringVar(&keepPolicy, "keep", "oldest", "With --duplicates, which copy to keep: oldest, newest, shortest-path, longest-name or in=<dir>")
+	viewCmd.Flags().StringVar(&inline, "inline", "", "Skip the config and read a single line from the flag's value")
+}
@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/electr1fy0/sorta/internal/config"
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/ignore"
+	"github.com/electr1fy0/sorta/internal/ops"
+	"github.com/electr1fy0/sorta/internal/sorter"
+	"github.com/electr1fy0/sorta/internal/watch"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <directory>",
+	Short: "Sort new files as they arrive (Linux only)",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := getDir(args)
+		if err != nil {
+			return err
+		}
+		if quietPeriod <= 0 {
+			return fmt.Errorf("--quiet-period must be positive")
+		}
+
+		release, err := watch.Lock(dir)
+		if err != nil {
+			return err
+		}
+		defer release()
+		// Empty folders in a watched directory may be ones the user just
+		// made to drop files into.
+		ops.KeepEmptyFolders = true
+
+		state := &watchState{dir: dir}
+		if err := state.load(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Printf("%sWatching:%s %s (quiet period %s, Ctrl+C to stop)\n", ansiCyan, ansiReset, dir, quietPeriod)
+		opts := watch.Options{
+			Quiet:    quietPeriod,
+			MaxDepth: ops.RecurseLevel,
+			Skip: func(path string, isDir bool) bool {
+				return state.ignore.Match(dir, path, isDir)
+			},
+		}
+		return watch.Watch(ctx, dir, opts, func(paths []string) {
+			state.sortBatch(ctx, paths)
+		})
+	},
+}
+
+// watchState holds the rules a watcher sorts with and reloads them when the
+// config or an ignore file changes.
+type watchState struct {
+	dir      string
+	sorter   *sorter.ConfigSorter
+	destRoot string
+	ignore   *ignore.IgnoreMatcher
+	stamp    string
+	// sorted remembers the files this watcher moved away, so one that
+	// reappears unchanged (brought back by undo) is not sorted again.
+	sorted map[string]time.Time
+}
+
+func (s *watchState) load() error {
+	configSorter, destRoot, err := newConfigSorter(s.dir)
+	if err != nil {
+		return err
+	}
+	ignoreMatcher, err := ignore.LoadIgnoreMatcher(s.dir, configSorter.GetBlacklist())
+	if err != nil {
+		return fmt.Errorf("failed to load ignore patterns: %w", err)
+	}
+	if destRoot != "" && destRoot != s.dir {
+		ignoreMatcher.ExcludeDir(destRoot)
+	}
+
+	s.sorter, s.destRoot, s.ignore = configSorter, destRoot, ignoreMatcher
+	s.stamp = s.currentStamp()
+	return nil
+}
+
+// currentStamp summarizes the modification times of every file the rules
+// are read from, so a change to any of them can be noticed.
+func (s *watchState) currentStamp() string {
+	paths := ignore.Files(s.dir)
+	if inline == "" {
+		if path, err := config.ResolveConfigPath(configPath, s.dir); err == nil {
+			paths = append(paths, path)
+		}
+	}
+
+	var sb strings.Builder
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s:%d:%d;", path, info.ModTime().UnixNano(), info.Size())
+	}
+	return sb.String()
+}
+
+func (s *watchState) reloadIfChanged() {
+	if s.currentStamp() == s.stamp {
+		return
+	}
+	if err := s.load(); err != nil {
+		fmt.Fprintf(os.Stderr, "config reload failed, keeping previous rules: %v\n", err)
+		return
+	}
+	fmt.Println("Reloaded config and ignore rules.")
+}
+
+func (s *watchState) sortBatch(ctx context.Context, paths []string) {
+	s.reloadIfChanged()
+
+	var files []core.FileEntry
+	for _, path := range paths {
+		if s.ignore.Match(s.dir, path, false) {
+			continue
+		}
+		file, err := ops.StatFile(s.dir, path)
+		if err != nil {
+			continue
+		}
+		if modTime, ok := s.sorted[path]; ok && modTime.Equal(file.ModTime) {
+			continue
+		}
+		files = append(files, file)
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	plannedOps, err := ops.PlanFilesCtx(ctx, files, s.sorter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to plan operations: %v\n", err)
+		return
+	}
+	var batch []core.FileOperation
+	for _, op := range plannedOps {
+		if op.OpType == core.OpSkip || op.DestPath == op.File.SourcePath {
+			continue
+		}
+		batch = append(batch, op)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	if dryRun {
+		for _, op := range batch {
+			rel, err := filepath.Rel(s.dir, op.DestPath)
+			if err != nil {
+				rel = op.DestPath
+			}
+			fmt.Printf("[dry-run] %s -> %s\n", filepath.Base(op.File.SourcePath), rel)
+		}
+		return
+	}
+
+	executor := &ops.Executor{DestRoot: s.destRoot, Cache: loadHashCache()}
+	result, err := ops.ApplyOperationsCtx(ctx, s.dir, batch, executor, &ops.Reporter{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to sort batch: %v\n", err)
+	}
+	if result != nil {
+		for _, e := range result.Errors {
+			fmt.Fprintf(os.Stderr, "  %v\n", e)
+		}
+	}
+	if err != nil {
+		return
+	}
+	if s.sorted == nil {
+		s.sorted = make(map[string]time.Time)
+	}
+	for _, op := range batch {
+		s.sorted[op.File.SourcePath] = op.File.ModTime
+	}
+}
+
+var quietPeriod time.Duration
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().DurationVar(&quietPeriod, "quiet-period", 5*time.Second, "How long a file must go unchanged before it is sorted")
+	watchCmd.Flags().StringVar(&inline, "inline", "", "Skip the config and read a single line from the flag's value")
+	watchCmd.Flags().StringVar(&destDir, "dest", "", "Sort files into this directory instead of the watched one")
+}
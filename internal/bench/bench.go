@@ -2,29 +2,51 @@ package bench
 
 import (
 	"context"
+	stdhash "hash"
+	"os"
 	"time"
 
 	"github.com/electr1fy0/sorta/internal/core"
 	"github.com/electr1fy0/sorta/internal/dupl"
+	"github.com/electr1fy0/sorta/internal/hash"
 	"github.com/electr1fy0/sorta/internal/ignore"
 	"github.com/electr1fy0/sorta/internal/ops"
 )
 
 type Report struct {
-	Directory string
-	Files     int
-	Ops       int
-	Dedupes   int
-	Stats     core.DuplicateStats
+	Directory  string
+	Algorithm  hash.Algorithm
+	Files      int
+	Ops        int
+	Dedupes    int
+	Stats      core.DuplicateStats
+	Algorithms []AlgorithmResult
+}
+
+// AlgorithmResult is how long one hash algorithm spent on the benchmark
+// files, not counting the time taken to read them.
+type AlgorithmResult struct {
+	Algorithm hash.Algorithm
+	Bytes     int64
+	Duration  time.Duration
+}
+
+// Throughput returns the hashing speed in MiB/s.
+func (r AlgorithmResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) / 1024.0 / 1024.0 / r.Duration.Seconds()
 }
 
 func BenchmarkDuplicates(rootDir string) (*Report, error) {
-	return BenchmarkDuplicatesCtx(context.Background(), rootDir, nil)
+	return BenchmarkDuplicatesCtx(context.Background(), rootDir, hash.DefaultAlgorithm, nil)
 }
 
 func BenchmarkDuplicatesCtx(
 	ctx context.Context,
 	rootDir string,
+	algo hash.Algorithm,
 	progress func(core.ProgressEvent),
 ) (*Report, error) {
 	start := time.Now()
@@ -45,6 +67,7 @@ func BenchmarkDuplicatesCtx(
 	walkDuration := time.Since(walkStart)
 
 	finder := dupl.NewDuplicateFinder()
+	finder.SetAlgorithm(algo)
 	finder.SetProgressReporter(progress)
 	decideStart := time.Now()
 	duplOps, err := finder.Decide(ctx, files)
@@ -65,11 +88,73 @@ func BenchmarkDuplicatesCtx(
 	stats.DecideDuration = decideDuration
 	stats.TotalDuration = time.Since(start)
 
+	algorithms, err := CompareAlgorithmsCtx(ctx, files, progress)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Report{
-		Directory: rootDir,
-		Files:     len(files),
-		Ops:       len(duplOps),
-		Dedupes:   dedupes,
-		Stats:     stats,
+		Directory:  rootDir,
+		Algorithm:  algo,
+		Files:      len(files),
+		Ops:        len(duplOps),
+		Dedupes:    dedupes,
+		Stats:      stats,
+		Algorithms: algorithms,
 	}, nil
 }
+
+// CompareAlgorithmsCtx reads every file once and feeds each chunk to all
+// supported algorithms in turn, timing only the hashing so disk speed and
+// page cache state don't favour whichever algorithm runs last.
+func CompareAlgorithmsCtx(
+	ctx context.Context,
+	files []core.FileEntry,
+	progress func(core.ProgressEvent),
+) ([]AlgorithmResult, error) {
+	results := make([]AlgorithmResult, len(hash.Algorithms))
+	for i, algo := range hash.Algorithms {
+		results[i].Algorithm = algo
+	}
+
+	buf := make([]byte, 1<<20)
+	hashers := make([]stdhash.Hash, len(results))
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(core.ProgressEvent{Stage: "compare", Completed: i, Total: len(files)})
+		}
+
+		f, err := os.Open(file.SourcePath)
+		if err != nil {
+			continue
+		}
+		for j := range results {
+			hashers[j] = results[j].Algorithm.New()
+		}
+		for {
+			n, err := f.Read(buf)
+			for j := range results {
+				t := time.Now()
+				hashers[j].Write(buf[:n])
+				results[j].Duration += time.Since(t)
+				results[j].Bytes += int64(n)
+			}
+			if err != nil {
+				break
+			}
+		}
+		f.Close()
+		for j := range results {
+			t := time.Now()
+			hashers[j].Sum(nil)
+			results[j].Duration += time.Since(t)
+		}
+	}
+	if progress != nil {
+		progress(core.ProgressEvent{Stage: "compare", Completed: len(files), Total: len(files)})
+	}
+	return results, nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+var ageUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+// parseComparison splits a leading comparison operator off s. A missing
+// operator means >=, so size(1GB) reads as "at least 1GB".
+func parseComparison(s string) (string, string) {
+	s = strings.TrimSpace(s)
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if rest, ok := strings.CutPrefix(s, op); ok {
+			return op, strings.TrimSpace(rest)
+		}
+	}
+	return ">=", s
+}
+
+func splitNumber(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	if i == 0 {
+		return 0, "", fmt.Errorf("missing number in %q", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, strings.ToLower(strings.TrimSpace(s[i:])), nil
+}
+
+func parseSize(s string) (int64, error) {
+	n, unit, err := splitNumber(s)
+	if err != nil {
+		return 0, err
+	}
+	mult, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q", unit)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+func parseAge(s string) (time.Duration, error) {
+	n, unit, err := splitNumber(s)
+	if err != nil {
+		return 0, err
+	}
+	mult, ok := ageUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown age unit %q (use s, m, h, d, w or y)", unit)
+	}
+	return time.Duration(n * float64(mult)), nil
+}
+
+func compare(op string, a, b int64) bool {
+	switch op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	default:
+		return a == b
+	}
+}
+
+// matchDate compares t against the whole calendar day starting at day, so
+// mtime(=2024-01-01) matches anything modified on that date.
+func matchDate(op string, t, day time.Time) bool {
+	if t.IsZero() {
+		return false
+	}
+	next := day.AddDate(0, 0, 1)
+	switch op {
+	case ">":
+		return !t.Before(next)
+	case ">=":
+		return !t.Before(day)
+	case "<":
+		return t.Before(day)
+	case "<=":
+		return t.Before(next)
+	default:
+		return !t.Before(day) && t.Before(next)
+	}
+}
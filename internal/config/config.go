@@ -4,24 +4,107 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/hash"
+	"github.com/electr1fy0/sorta/internal/sniff"
 	"github.com/electr1fy0/sorta/templates"
 )
 
 type ConfigData struct {
 	Foldernames []string
 	Matchers    [][]Matcher
-	Blacklist   []string
-	Warnings    []string
+	Options     []RuleOptions
+	Root        string
+	Keep        []string
+	// Hash is the algorithm named by an @hash line, or "" for the default.
+	Hash      string
+	Blacklist []string
+	Warnings  []string
 }
 
+// RuleOptions holds the key=value settings that can appear alongside the
+// matchers of a rule, e.g. Photos/{year} = ext(jpg), date=name.
+type RuleOptions struct {
+	DateSource string
+	Conflict   core.ConflictPolicy
+	Action     core.OperationType
+}
+
+type MatcherKind int
+
+const (
+	MatchKeyword MatcherKind = iota
+	MatchRegex
+	MatchExt
+	MatchGlob
+	MatchPath
+	MatchSize
+	MatchOlder
+	MatchNewer
+	MatchMtime
+	MatchMime
+	MatchKind
+	MatchAll
+)
+
+var matcherKinds = map[string]MatcherKind{
+	"name":  MatchKeyword,
+	"regex": MatchRegex,
+	"ext":   MatchExt,
+	"glob":  MatchGlob,
+	"path":  MatchPath,
+	"size":  MatchSize,
+	"older": MatchOlder,
+	"newer": MatchNewer,
+	"mtime": MatchMtime,
+	"mime":  MatchMime,
+	"kind":  MatchKind,
+}
+
+var matcherNames = map[MatcherKind]string{
+	MatchKeyword: "name",
+	MatchRegex:   "regex",
+	MatchExt:     "ext",
+	MatchGlob:    "glob",
+	MatchPath:    "path",
+	MatchSize:    "size",
+	MatchOlder:   "older",
+	MatchNewer:   "newer",
+	MatchMtime:   "mtime",
+	MatchMime:    "mime",
+	MatchKind:    "kind",
+}
+
+// Matcher is a single rule keyword. Bare keywords are substring matches on
+// the filename; the typed forms are written as kind(args), optionally
+// followed by an i for case-insensitive matching, e.g. ext(pdf,docx)i.
+// Matchers joined with & form a MatchAll that requires every part to match.
 type Matcher struct {
+	Kind  MatcherKind
 	Raw   string
 	Regex *regexp.Regexp
+	Exts  []string
+	Types []string
+	Fold  bool
+	Cmp   string
+	Bytes int64
+	Age   time.Duration
+	Date  time.Time
+	All   []Matcher
+}
+
+type candidate struct {
+	file core.FileEntry
+	name string
+	rel  string
+	now  time.Time
 }
 
 func LoadConfig(explicitPath, targetDir string) (*ConfigData, string, error) {
@@ -74,18 +157,258 @@ func createGlobalConfig(dir, path string) error {
 	return os.WriteFile(path, []byte(templates.DefaultConfig), 0644)
 }
 
+// isTyped reports whether k is written as a typed matcher, kind(args).
+func isTyped(k string) bool {
+	open := strings.IndexByte(k, '(')
+	if open <= 0 {
+		return false
+	}
+	_, ok := matcherKinds[k[:open]]
+	return ok
+}
+
 func parseMatcher(k string) (Matcher, error) {
-	if trimmed, ok := strings.CutPrefix(k, "regex("); ok {
-		if trimmed, ok = strings.CutSuffix(trimmed, ")"); ok {
-			re, err := regexp.Compile(trimmed)
+	// & only joins matchers when one of them is typed, so a bare keyword
+	// such as "Tom & Jerry" keeps matching literally.
+	if parts := splitTopLevel(k, '&'); len(parts) > 1 && slices.ContainsFunc(parts, func(p string) bool {
+		return isTyped(strings.TrimSpace(p))
+	}) {
+		m := Matcher{Kind: MatchAll}
+		for _, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				return Matcher{}, fmt.Errorf("empty condition in %q", k)
+			}
+			sub, err := parseMatcher(part)
 			if err != nil {
-				return Matcher{}, fmt.Errorf("invalid regex %q: %w", trimmed, err)
+				return Matcher{}, err
+			}
+			m.All = append(m.All, sub)
+		}
+		return m, nil
+	}
+
+	open := strings.IndexByte(k, '(')
+	if open <= 0 {
+		return Matcher{Kind: MatchKeyword, Raw: k}, nil
+	}
+	kind, ok := matcherKinds[k[:open]]
+	if !ok {
+		return Matcher{Kind: MatchKeyword, Raw: k}, nil
+	}
+
+	body := k[open+1:]
+	fold := false
+	if trimmed, ok := strings.CutSuffix(body, ")i"); ok {
+		body, fold = trimmed, true
+	} else if trimmed, ok := strings.CutSuffix(body, ")"); ok {
+		body = trimmed
+	} else {
+		return Matcher{}, fmt.Errorf("malformed %s matcher %q", k[:open], k)
+	}
+	if body == "" {
+		return Matcher{}, fmt.Errorf("empty %s matcher %q", k[:open], k)
+	}
+
+	if fold && kind >= MatchSize {
+		return Matcher{}, fmt.Errorf("%s matcher %q does not support the i modifier", k[:open], k)
+	}
+
+	m := Matcher{Kind: kind, Raw: body, Fold: fold}
+	switch kind {
+	case MatchRegex:
+		expr := body
+		if fold {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return Matcher{}, fmt.Errorf("invalid regex %q: %w", body, err)
+		}
+		m.Regex = re
+	case MatchExt:
+		for _, ext := range strings.Split(body, ",") {
+			ext = strings.TrimPrefix(strings.TrimSpace(ext), ".")
+			if ext == "" {
+				continue
+			}
+			m.Exts = append(m.Exts, ext)
+		}
+		if len(m.Exts) == 0 {
+			return Matcher{}, fmt.Errorf("empty ext matcher %q", k)
+		}
+	case MatchGlob, MatchPath:
+		if _, err := path.Match(body, ""); err != nil {
+			return Matcher{}, fmt.Errorf("invalid %s pattern %q: %w", k[:open], body, err)
+		}
+	case MatchSize:
+		cmp, rest := parseComparison(body)
+		n, err := parseSize(rest)
+		if err != nil {
+			return Matcher{}, fmt.Errorf("invalid size matcher %q: %w", k, err)
+		}
+		m.Cmp, m.Bytes = cmp, n
+	case MatchOlder, MatchNewer:
+		d, err := parseAge(body)
+		if err != nil {
+			return Matcher{}, fmt.Errorf("invalid %s matcher %q: %w", k[:open], k, err)
+		}
+		m.Age = d
+	case MatchMtime:
+		cmp, rest := parseComparison(body)
+		date, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(rest), time.Local)
+		if err != nil {
+			return Matcher{}, fmt.Errorf("invalid mtime matcher %q: expected a YYYY-MM-DD date", k)
+		}
+		m.Cmp, m.Date = cmp, date
+	case MatchMime, MatchKind:
+		for _, t := range strings.Split(body, ",") {
+			t = strings.ToLower(strings.TrimSpace(t))
+			if t == "" {
+				continue
+			}
+			if kind == MatchMime {
+				if _, err := path.Match(t, ""); err != nil {
+					return Matcher{}, fmt.Errorf("invalid mime pattern %q: %w", t, err)
+				}
+			}
+			m.Types = append(m.Types, t)
+		}
+		if len(m.Types) == 0 {
+			return Matcher{}, fmt.Errorf("empty %s matcher %q", k[:open], k)
+		}
+	}
+	return m, nil
+}
+
+// splitMatchers splits a comma-separated matcher list, leaving commas inside
+// parentheses such as ext(pdf,docx) untouched.
+func splitMatchers(s string) []string {
+	return splitTopLevel(s, ',')
+}
+
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func (m Matcher) String() string {
+	if m.Kind == MatchAll {
+		parts := make([]string, 0, len(m.All))
+		for _, sub := range m.All {
+			parts = append(parts, sub.String())
+		}
+		return strings.Join(parts, " & ")
+	}
+	if m.Kind == MatchKeyword && !m.Fold {
+		return m.Raw
+	}
+
+	body := m.Raw
+	switch m.Kind {
+	case MatchExt:
+		body = strings.Join(m.Exts, ",")
+	case MatchMime, MatchKind:
+		body = strings.Join(m.Types, ",")
+	}
+	s := fmt.Sprintf("%s(%s)", matcherNames[m.Kind], body)
+	if m.Fold {
+		s += "i"
+	}
+	return s
+}
+
+func (m Matcher) match(c candidate) bool {
+	name, rel := c.name, c.rel
+	switch m.Kind {
+	case MatchRegex:
+		return m.Regex.MatchString(name)
+	case MatchSize:
+		return compare(m.Cmp, c.file.Size, m.Bytes)
+	case MatchOlder:
+		return !c.file.ModTime.IsZero() && c.now.Sub(c.file.ModTime) > m.Age
+	case MatchNewer:
+		return !c.file.ModTime.IsZero() && c.now.Sub(c.file.ModTime) <= m.Age
+	case MatchMtime:
+		return matchDate(m.Cmp, c.file.ModTime, m.Date)
+	case MatchMime, MatchKind:
+		return m.matchType(c)
+	case MatchAll:
+		for _, sub := range m.All {
+			if !sub.match(c) {
+				return false
+			}
+		}
+		return true
+	}
+
+	pattern := m.Raw
+	if m.Fold {
+		pattern = strings.ToLower(pattern)
+		name, rel = strings.ToLower(name), strings.ToLower(rel)
+	}
+
+	switch m.Kind {
+	case MatchExt:
+		for _, ext := range m.Exts {
+			if m.Fold {
+				ext = strings.ToLower(ext)
+			}
+			if len(name) > len(ext)+1 && strings.HasSuffix(name, "."+ext) {
+				return true
+			}
+		}
+		return false
+	case MatchGlob:
+		ok, _ := path.Match(pattern, name)
+		return ok
+	case MatchPath:
+		for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+		return false
+	default:
+		return strings.Contains(name, pattern)
+	}
+}
+
+func (m Matcher) matchType(c candidate) bool {
+	head, err := sniff.Head(c.file)
+	if err != nil {
+		return false
+	}
+	for _, t := range m.Types {
+		if m.Kind == MatchKind {
+			if sniff.Kind(head.Type) == t {
+				return true
 			}
-			return Matcher{Regex: re}, nil
+			continue
+		}
+		if ok, _ := path.Match(t, head.Type); ok {
+			return true
 		}
-		return Matcher{}, fmt.Errorf("malformed regex matcher %q", k)
 	}
-	return Matcher{Raw: k}, nil
+	return false
 }
 
 func ParseInline(s string) (*ConfigData, error) {
@@ -95,12 +418,23 @@ func ParseInline(s string) (*ConfigData, error) {
 	}
 	foldername := strings.TrimSpace(parts[0])
 
+	if err := validateTemplate(foldername); err != nil {
+		return nil, err
+	}
+
 	var matchers []Matcher
-	for _, k := range strings.Split(parts[1], ",") {
+	var opts RuleOptions
+	for _, k := range splitMatchers(parts[1]) {
 		k = strings.TrimSpace(k)
 		if k == "" {
 			continue
 		}
+		if ok, err := parseOption(k, &opts); ok {
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
 		m, err := parseMatcher(k)
 		if err != nil {
 			return nil, err
@@ -111,9 +445,79 @@ func ParseInline(s string) (*ConfigData, error) {
 	return &ConfigData{
 		Foldernames: []string{foldername},
 		Matchers:    [][]Matcher{matchers},
+		Options:     []RuleOptions{opts},
 	}, nil
 }
 
+// parseSetting applies the @name = value line at lineNo.
+func (configData *ConfigData) parseSetting(lineNo int, name, value string) {
+	switch name {
+	case "root":
+		configData.Root = strings.TrimSpace(value)
+	case "keep":
+		for _, dir := range strings.Split(value, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				configData.Keep = append(configData.Keep, dir)
+			}
+		}
+	case "hash":
+		algo := strings.TrimSpace(value)
+		if _, err := hash.ParseAlgorithm(algo); err != nil {
+			configData.Warnings = append(configData.Warnings, fmt.Sprintf("line %d: %v", lineNo, err))
+			return
+		}
+		configData.Hash = algo
+	default:
+		configData.Warnings = append(configData.Warnings, fmt.Sprintf("line %d ignored: unknown setting @%s", lineNo, name))
+	}
+}
+
+// ReadSettings reads only the @ settings of the config that applies to
+// targetDir. Unlike LoadConfig it never creates the global config and
+// skips the rules, so it prints nothing; Warnings only covers the
+// settings. With no config at all, the settings are empty.
+func ReadSettings(explicitPath, targetDir string) (*ConfigData, error) {
+	path := explicitPath
+	if path == "" {
+		var candidates []string
+		if targetDir != "" {
+			candidates = append(candidates, filepath.Join(targetDir, ".sorta", "config"))
+		}
+		if globalDir, err := core.GetSortaDir(); err == nil {
+			candidates = append(candidates, filepath.Join(globalDir, "config"))
+		}
+		for _, c := range candidates {
+			if _, err := os.Stat(c); err == nil {
+				path = c
+				break
+			}
+		}
+		if path == "" {
+			return &ConfigData{}, nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+	var configData ConfigData
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		folder, value, found := strings.Cut(scanner.Text(), "=")
+		if name, ok := strings.CutPrefix(strings.TrimSpace(folder), "@"); ok && found {
+			configData.parseSetting(lineNo, name, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return &configData, nil
+}
+
 func ParseConfig(configPath string) (*ConfigData, error) {
 	file, err := os.Open(configPath)
 	if err != nil {
@@ -126,6 +530,7 @@ func ParseConfig(configPath string) (*ConfigData, error) {
 	var configData ConfigData
 	configData.Foldernames = make([]string, 0, 50)
 	configData.Matchers = make([][]Matcher, 0, 50)
+	configData.Options = make([]RuleOptions, 0, 50)
 	configData.Blacklist = make([]string, 0, 10)
 	configData.Warnings = make([]string, 0, 8)
 
@@ -153,14 +558,34 @@ func ParseConfig(configPath string) (*ConfigData, error) {
 			configData.Warnings = append(configData.Warnings, fmt.Sprintf("line %d ignored: empty folder name", lineNo))
 			continue
 		}
-		keywords := strings.Split(parts[1], ",")
+		// Settings are written as @name = value, so they can't be mistaken
+		// for a folder.
+		if name, ok := strings.CutPrefix(folder, "@"); ok {
+			configData.parseSetting(lineNo, name, parts[1])
+			continue
+		}
+		if folder == "root" && strings.ContainsAny(parts[1], `/\`) {
+			configData.Warnings = append(configData.Warnings, fmt.Sprintf("line %d: sorted into a folder named root; the destination setting is written @root", lineNo))
+		}
+		if err := validateTemplate(folder); err != nil {
+			configData.Warnings = append(configData.Warnings, fmt.Sprintf("line %d ignored: %v", lineNo, err))
+			continue
+		}
+		keywords := splitMatchers(parts[1])
 		matchers := make([]Matcher, 0, len(keywords))
+		var opts RuleOptions
 		for _, k := range keywords {
 			k = strings.TrimSpace(k)
 			if k == "" {
 				configData.Warnings = append(configData.Warnings, fmt.Sprintf("line %d: empty matcher in folder %q", lineNo, folder))
 				continue
 			}
+			if ok, err := parseOption(k, &opts); ok {
+				if err != nil {
+					configData.Warnings = append(configData.Warnings, fmt.Sprintf("line %d: %v", lineNo, err))
+				}
+				continue
+			}
 			m, err := parseMatcher(k)
 			if err != nil {
 				configData.Warnings = append(configData.Warnings, fmt.Sprintf("line %d: %v", lineNo, err))
@@ -170,6 +595,7 @@ func ParseConfig(configPath string) (*ConfigData, error) {
 		}
 		configData.Foldernames = append(configData.Foldernames, folder)
 		configData.Matchers = append(configData.Matchers, matchers)
+		configData.Options = append(configData.Options, opts)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -183,25 +609,46 @@ func ParseConfig(configPath string) (*ConfigData, error) {
 	return &configData, nil
 }
 
-func Categorize(configData ConfigData, filename string) string {
-	fallback := ""
-	for i, foldername := range configData.Foldernames {
-		for _, matcher := range configData.Matchers[i] {
-			if matcher.Regex != nil {
-				if matcher.Regex.MatchString(filename) {
-					return foldername
-				}
-				continue
-			}
+// Categorize returns the destination folder for file, relative to the root,
+// with any date placeholders in the folder name already expanded, together
+// with the options of the rule that matched.
+func Categorize(configData ConfigData, file core.FileEntry) (string, RuleOptions) {
+	filename := filepath.Base(file.SourcePath)
+	rel, err := filepath.Rel(file.RootDir, file.SourcePath)
+	if err != nil {
+		rel = filename
+	}
+	c := candidate{file: file, name: filename, rel: filepath.ToSlash(rel), now: time.Now()}
 
-			if matcher.Raw == "*" {
-				fallback = foldername
+	fallback := -1
+	for i := range configData.Foldernames {
+		for _, matcher := range configData.Matchers[i] {
+			if matcher.Kind == MatchKeyword && !matcher.Fold && matcher.Raw == "*" {
+				fallback = i
 			}
-			if strings.Contains(filename, matcher.Raw) {
-				return foldername
+			if matcher.match(c) {
+				return configData.resolveFolder(i, c), configData.OptionsFor(i)
 			}
 		}
 	}
 
-	return fallback
+	if fallback < 0 {
+		return "", RuleOptions{}
+	}
+	return configData.resolveFolder(fallback, c), configData.OptionsFor(fallback)
+}
+
+func (configData ConfigData) OptionsFor(i int) RuleOptions {
+	if i < 0 || i >= len(configData.Options) {
+		return RuleOptions{}
+	}
+	return configData.Options[i]
+}
+
+func (configData ConfigData) resolveFolder(i int, c candidate) string {
+	folder := configData.Foldernames[i]
+	if !strings.Contains(folder, "{") {
+		return folder
+	}
+	return expandTemplate(folder, fileDate(c, configData.OptionsFor(i).DateSource))
 }
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/electr1fy0/sorta/internal/core"
+)
+
+var placeholderRe = regexp.MustCompile(`\{([a-z]+)\}`)
+
+var nameDateRe = regexp.MustCompile(`(?:^|\D)((?:19|20)\d{2})[-_.]?(0[1-9]|1[0-2])[-_.]?(0[1-9]|[12]\d|3[01])(?:\D|$)`)
+
+var placeholders = map[string]func(time.Time) string{
+	"year":      func(t time.Time) string { return t.Format("2006") },
+	"yyyy":      func(t time.Time) string { return t.Format("2006") },
+	"yy":        func(t time.Time) string { return t.Format("06") },
+	"month":     func(t time.Time) string { return t.Format("01") },
+	"mm":        func(t time.Time) string { return t.Format("01") },
+	"monthname": func(t time.Time) string { return t.Format("January") },
+	"mon":       func(t time.Time) string { return t.Format("Jan") },
+	"day":       func(t time.Time) string { return t.Format("02") },
+	"dd":        func(t time.Time) string { return t.Format("02") },
+	"quarter":   func(t time.Time) string { return strconv.Itoa((int(t.Month())-1)/3 + 1) },
+	"week": func(t time.Time) string {
+		_, week := t.ISOWeek()
+		return fmt.Sprintf("%02d", week)
+	},
+}
+
+var dateSources = map[string]bool{
+	"mtime": true,
+	"name":  true,
+	"now":   true,
+}
+
+var ruleOptionKeys = map[string]bool{
+	"date":     true,
+	"conflict": true,
+	"action":   true,
+}
+
+// parseOption reports whether k is a key=value rule option rather than a
+// matcher, and stores its value in opts.
+func parseOption(k string, opts *RuleOptions) (bool, error) {
+	key, value, ok := strings.Cut(k, "=")
+	if !ok {
+		return false, nil
+	}
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !ruleOptionKeys[key] {
+		return false, nil
+	}
+
+	switch key {
+	case "date":
+		if !dateSources[value] {
+			return true, fmt.Errorf("unknown date source %q (use mtime, name or now)", value)
+		}
+		opts.DateSource = value
+	case "conflict":
+		policy, err := core.ParseConflictPolicy(value)
+		if err != nil {
+			return true, err
+		}
+		opts.Conflict = policy
+	case "action":
+		action, err := core.ParseAction(value)
+		if err != nil {
+			return true, err
+		}
+		opts.Action = action
+	}
+	return true, nil
+}
+
+func (o RuleOptions) String() string {
+	var parts []string
+	if o.DateSource != "" {
+		parts = append(parts, "date="+o.DateSource)
+	}
+	if o.Conflict != core.ConflictSuffix {
+		parts = append(parts, "conflict="+o.Conflict.String())
+	}
+	switch o.Action {
+	case core.OpCopy:
+		parts = append(parts, "action=copy")
+	case core.OpSymlink:
+		parts = append(parts, "action=link")
+	case core.OpHardlink:
+		parts = append(parts, "action=hardlink")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func validateTemplate(folder string) error {
+	for _, m := range placeholderRe.FindAllStringSubmatch(folder, -1) {
+		if _, ok := placeholders[m[1]]; !ok {
+			return fmt.Errorf("unknown placeholder %s in folder %q", m[0], folder)
+		}
+	}
+	return nil
+}
+
+func expandTemplate(folder string, t time.Time) string {
+	return placeholderRe.ReplaceAllStringFunc(folder, func(m string) string {
+		fn, ok := placeholders[m[1:len(m)-1]]
+		if !ok {
+			return m
+		}
+		return fn(t)
+	})
+}
+
+// fileDate picks the date used to expand a folder template. The name source
+// looks for a YYYYMMDD or YYYY-MM-DD date in the filename and falls back to
+// the modification time when there is none.
+func fileDate(c candidate, source string) time.Time {
+	switch source {
+	case "now":
+		return c.now
+	case "name":
+		if t, ok := dateFromName(c.name); ok {
+			return t
+		}
+	}
+	if c.file.ModTime.IsZero() {
+		return c.now
+	}
+	return c.file.ModTime
+}
+
+func dateFromName(name string) (time.Time, bool) {
+	m := nameDateRe.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, false
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local)
+	if t.Day() != day {
+		return time.Time{}, false
+	}
+	return t, true
+}
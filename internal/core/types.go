@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
@@ -26,6 +28,73 @@ const (
 	OpDelete
 	OpSkip
 	OpUndo
+	OpCopy
+	OpSymlink
+	OpHardlink
+	// OpRelinkHard and OpRelinkReflink replace a duplicate in place with a
+	// hardlink or reflink to its keeper, which DestPath points at.
+	OpRelinkHard
+	OpRelinkReflink
+)
+
+// ParseAction maps a rule's action= value to the operation it plans.
+func ParseAction(s string) (OperationType, error) {
+	switch s {
+	case "move":
+		return OpMove, nil
+	case "copy":
+		return OpCopy, nil
+	case "link", "symlink":
+		return OpSymlink, nil
+	case "hardlink":
+		return OpHardlink, nil
+	}
+	return OpMove, fmt.Errorf("unknown action %q (use move, copy, link, symlink or hardlink)", s)
+}
+
+// ConflictPolicy decides what happens when a planned destination is already
+// taken, either on disk or by another planned operation.
+type ConflictPolicy int
+
+const (
+	ConflictSuffix ConflictPolicy = iota
+	ConflictSkip
+	ConflictKeepNewer
+	ConflictKeepLarger
+	ConflictDedupe
+)
+
+var conflictPolicyNames = map[ConflictPolicy]string{
+	ConflictSuffix:     "suffix",
+	ConflictSkip:       "skip",
+	ConflictKeepNewer:  "keep-newer",
+	ConflictKeepLarger: "keep-larger",
+	ConflictDedupe:     "dedupe-if-identical",
+}
+
+func (p ConflictPolicy) String() string {
+	return conflictPolicyNames[p]
+}
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for p, name := range conflictPolicyNames {
+		if name == s {
+			return p, nil
+		}
+	}
+	return ConflictSuffix, fmt.Errorf("unknown conflict policy %q (use suffix, skip, keep-newer, keep-larger or dedupe-if-identical)", s)
+}
+
+// Resolution records how a destination conflict was settled during planning.
+type Resolution int
+
+const (
+	ResolveNone Resolution = iota
+	ResolveSuffixed
+	ResolveSkipped
+	ResolveReplaced
+	ResolveDeduped
+	ResolvePresent
 )
 
 type TransactionType int
@@ -33,6 +102,7 @@ type TransactionType int
 const (
 	TAction TransactionType = iota
 	TUndo
+	TRedo
 )
 
 type Transaction struct {
@@ -40,19 +110,73 @@ type Transaction struct {
 	TType        TransactionType
 	Operations   []FileOperation
 	Irreversible bool
+	Root         string
+	DestRoot     string
+	// RemovedDirs lists the folders removed for being left empty.
+	RemovedDirs []string `json:",omitempty"`
+	// Reverts is the ID of the transaction an undo reverts, or of the undo
+	// a redo reverts.
+	Reverts string `json:",omitempty"`
+}
+
+// RootDir returns the directory the transaction was run on. Entries written
+// before Root was recorded fall back to the root of the first operation.
+func (t Transaction) RootDir() string {
+	if t.Root != "" {
+		return t.Root
+	}
+	if len(t.Operations) > 0 {
+		return t.Operations[0].File.RootDir
+	}
+	return ""
 }
 
 type FileEntry struct {
 	RootDir    string
 	SourcePath string
 	Size       int64
+	ModTime    time.Time
+	Mode       fs.FileMode
 }
 
 type FileOperation struct {
-	OpType   OperationType
-	File     FileEntry
-	DestPath string
-	Size     int64
+	OpType     OperationType
+	File       FileEntry
+	DestPath   string
+	Size       int64
+	Conflict   ConflictPolicy
+	Resolution Resolution
+	// Keeper is the copy left in place when a duplicate is moved away.
+	Keeper string
+	// Placed identifies the file the operation left at DestPath, so undo
+	// can tell it apart from a different file put there since.
+	Placed *FileID `json:",omitempty"`
+}
+
+// FileID identifies a file by device and inode, which stay the same when
+// it is renamed.
+type FileID struct {
+	Device uint64
+	Inode  uint64
+}
+
+// ConflictNote describes how a destination conflict was resolved for op, or
+// returns "" if it had none.
+func (op FileOperation) ConflictNote() string {
+	switch op.Resolution {
+	case ResolveSuffixed:
+		return "renamed to " + filepath.Base(op.DestPath)
+	case ResolveSkipped:
+		return "destination taken"
+	case ResolveReplaced:
+		return "replaces existing file"
+	case ResolveDeduped:
+		return "identical to existing file"
+	case ResolvePresent:
+		return "already in place"
+	default:
+		return ""
+	}
 }
 
 type Sorter interface {
@@ -63,6 +187,7 @@ type DuplicateStats struct {
 	FilesSeen      int
 	PartialHashed  int
 	FullHashed     int
+	ImagesHashed   int
 	CacheHits      int
 	CacheMisses    int
 	BytesHashed    int64
@@ -81,23 +206,70 @@ type SortResult struct {
 	Moved   int
 	Renamed int
 	Deduped int
+	Copied  int
+	Linked  int
 	Skipped int
 	Deleted int
-	Errors  []error
+	// Reclaimed counts the bytes freed by replacing duplicates with links.
+	Reclaimed int64
+	// Unverified lists duplicates left alone because they didn't match
+	// their keeper byte for byte.
+	Unverified []error
+	// Restored counts files put back from the trash, and Conflicts lists
+	// what undo left alone because it changed after the operation.
+	Restored  int
+	Conflicts []error
+	Errors    []error
 }
 
 func (r *SortResult) PrintSummary() {
 	fmt.Println("--------------------------------------------------")
 	if r.Moved > 0 {
 		fmt.Printf("  %sMoved:%s %d\n", ansiGreen, ansiReset, r.Moved)
-	} else if r.Deduped > 0 {
+	}
+	if r.Deduped > 0 {
 		fmt.Printf("  %sDeduped:%s %d\n", ansiGreen, ansiReset, r.Deduped)
-	} else if r.Renamed > 0 {
+	}
+	if r.Renamed > 0 {
 		fmt.Printf("  %sRenamed:%s %d\n", ansiGreen, ansiReset, r.Renamed)
 	}
+	if r.Copied > 0 {
+		fmt.Printf("  %sCopied:%s %d\n", ansiGreen, ansiReset, r.Copied)
+	}
+	if r.Linked > 0 {
+		fmt.Printf("  %sLinked:%s %d\n", ansiGreen, ansiReset, r.Linked)
+	}
+
+	if r.Reclaimed > 0 {
+		fmt.Printf("  %sReclaimed:%s %s\n", ansiGreen, ansiReset, HumanReadable(r.Reclaimed))
+	}
+
+	if r.Restored > 0 {
+		fmt.Printf("  %sRestored:%s %d\n", ansiGreen, ansiReset, r.Restored)
+	}
 
 	fmt.Printf("  %sDeleted:%s %d\n", ansiRed, ansiReset, r.Deleted)
 	fmt.Printf("  %sSkipped:%s %d\n", ansiYellow, ansiReset, r.Skipped)
+	if len(r.Unverified) > 0 {
+		fmt.Printf("  %sFailed verification:%s %d (left in place)\n", ansiYellow, ansiReset, len(r.Unverified))
+		for i, err := range r.Unverified {
+			if i == 10 {
+				fmt.Printf("    ... and %d more\n", len(r.Unverified)-i)
+				break
+			}
+			fmt.Printf("    - %s\n", err)
+		}
+	}
+	if len(r.Conflicts) > 0 {
+		fmt.Printf("  %sConflicts:%s %d (left in place)\n", ansiYellow, ansiReset, len(r.Conflicts))
+		for i, err := range r.Conflicts {
+			if i == 10 {
+				fmt.Printf("    ... and %d more\n", len(r.Conflicts)-i)
+				break
+			}
+			fmt.Printf("    - %s\n", err)
+		}
+	}
 	if len(r.Errors) > 0 {
 		fmt.Printf("  %sErrors:%s  %d\n", ansiRed, ansiReset, len(r.Errors))
 
@@ -129,6 +301,9 @@ func classifyError(err error) string {
 	if errors.Is(err, os.ErrNotExist) {
 		return "not_found"
 	}
+	if errors.Is(err, os.ErrExist) {
+		return "collision"
+	}
 	if errors.Is(err, os.ErrPermission) {
 		return "permission"
 	}
@@ -68,22 +68,3 @@ func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
 
 	return os.Rename(tmpPath, path)
 }
-
-func AppendLineAtomic(path string, line string, perm os.FileMode) error {
-	var existing []byte
-	data, err := os.ReadFile(path)
-	if err == nil {
-		existing = data
-	} else if !os.IsNotExist(err) {
-		return err
-	}
-
-	buf := make([]byte, 0, len(existing)+len(line)+1)
-	buf = append(buf, existing...)
-	buf = append(buf, line...)
-	if len(line) == 0 || line[len(line)-1] != '\n' {
-		buf = append(buf, '\n')
-	}
-
-	return WriteFileAtomic(path, buf, perm)
-}
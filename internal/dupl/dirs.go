@@ -0,0 +1,371 @@
+package dupl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/electr1fy0/sorta/internal/core"
+)
+
+// SetDirectories switches to comparing whole directory trees: folders with
+// identical contents, or whose contents all exist in another folder, become
+// one group each instead of a group per file.
+func (d *DuplicateFinder) SetDirectories(on bool) {
+	d.dirs = on
+}
+
+// dirNode is a directory below the scanned root that holds files.
+type dirNode struct {
+	path  string
+	depth int
+	// files maps each file below the directory, by path relative to it,
+	// to its content hash.
+	files map[string]string
+	// direct holds the hashes of the files directly inside, by name, and
+	// subdirs the names of subdirectories that hold files.
+	direct  map[string]string
+	subdirs map[string]bool
+	size    int64
+	merkle  string
+	// incomplete is set when the directory, or one below it, holds
+	// something the scan left out.
+	incomplete bool
+}
+
+// findDirGroups hashes the files, folds the hashes into a Merkle hash per
+// directory, and groups directories that are identical or strict subsets of
+// another directory.
+func (d *DuplicateFinder) findDirGroups(ctx context.Context, files []core.FileEntry) ([]Group, int, error) {
+	d.setFilesSeen(len(files))
+	files, _ = filterValidFiles(files)
+	if len(files) == 0 {
+		return nil, 0, nil
+	}
+
+	// A file whose size is unique can't be in another directory, so it
+	// gets a token no other file shares instead of a real hash.
+	var candidates []core.FileEntry
+	tokens := make(map[string]string, len(files))
+	for _, group := range groupBySize(files) {
+		if len(group) > 1 {
+			candidates = append(candidates, group...)
+			continue
+		}
+		tokens[group[0].SourcePath] = "unique:" + group[0].SourcePath
+	}
+	hashes, err := d.hashFiles(ctx, candidates, "full", d.fullHashWithCache)
+	if err != nil {
+		return nil, 0, err
+	}
+	for path, h := range hashes {
+		tokens[path] = h
+	}
+
+	nodes := buildDirNodes(files, tokens)
+	markIncomplete(nodes)
+	d.computeMerkle(nodes)
+
+	entries := make(map[string]core.FileEntry, len(nodes))
+	for path, n := range nodes {
+		entry := core.FileEntry{RootDir: files[0].RootDir, SourcePath: path, Size: n.size}
+		if info, err := os.Stat(path); err == nil {
+			entry.ModTime = info.ModTime()
+			entry.Mode = info.Mode()
+		}
+		entries[path] = entry
+	}
+
+	// Identical trees first, shallowest first, so a duplicated folder is
+	// reported once rather than once per level.
+	byMerkle := make(map[string][]*dirNode)
+	for _, n := range nodes {
+		byMerkle[n.merkle] = append(byMerkle[n.merkle], n)
+	}
+	var identical [][]*dirNode
+	for _, group := range byMerkle {
+		if len(group) > 1 {
+			identical = append(identical, group)
+		}
+	}
+	sort.Slice(identical, func(i, j int) bool {
+		return minDepth(identical[i]) < minDepth(identical[j]) ||
+			(minDepth(identical[i]) == minDepth(identical[j]) && identical[i][0].merkle < identical[j][0].merkle)
+	})
+
+	// A directory inside one that is kept can still be the keeper for a
+	// copy elsewhere, but is never moved itself.
+	var groups []Group
+	moved := make(map[string]bool)
+	kept := make(map[string]bool)
+	for _, group := range identical {
+		var movable, keepOnly []core.FileEntry
+		for _, n := range group {
+			switch {
+			case underAny(n.path, moved):
+			case n.incomplete || underAny(n.path, kept) || containsAny(n.path, kept):
+				keepOnly = append(keepOnly, entries[n.path])
+			default:
+				movable = append(movable, entries[n.path])
+			}
+		}
+
+		var keeper core.FileEntry
+		var dupes []core.FileEntry
+		if len(keepOnly) > 0 {
+			keeper, dupes = d.keep.Choose(keepOnly)[0], d.keep.Choose(movable)
+		} else if len(movable) > 0 {
+			ordered := d.keep.Choose(movable)
+			keeper, dupes = ordered[0], ordered[1:]
+		}
+		if len(dupes) == 0 {
+			continue
+		}
+		for _, f := range dupes {
+			moved[f.SourcePath] = true
+		}
+		kept[keeper.SourcePath] = true
+		groups = append(groups, Group{Hash: group[0].merkle, Keeper: keeper, Duplicates: dupes})
+	}
+
+	groups = append(groups, d.subsetGroups(nodes, entries, moved, kept)...)
+	groups = dropNested(groups, moved)
+	sortGroups(groups)
+
+	involved := len(moved) + len(kept)
+	if d.cache != nil {
+		if err := d.cache.Save(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return groups, max(0, len(nodes)-involved), nil
+}
+
+// subsetGroups finds directories whose every file, at the same relative
+// path, also exists in a larger directory. Each is grouped with the largest
+// such directory, which is kept.
+func (d *DuplicateFinder) subsetGroups(nodes map[string]*dirNode, entries map[string]core.FileEntry, moved, kept map[string]bool) []Group {
+	holders := make(map[string][]*dirNode)
+	for _, n := range nodes {
+		for rel, h := range n.files {
+			key := rel + "\x00" + h
+			holders[key] = append(holders[key], n)
+		}
+	}
+
+	ordered := make([]*dirNode, 0, len(nodes))
+	for _, n := range nodes {
+		ordered = append(ordered, n)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].depth < ordered[j].depth ||
+			(ordered[i].depth == ordered[j].depth && ordered[i].path < ordered[j].path)
+	})
+
+	var groups []Group
+	for _, a := range ordered {
+		if a.incomplete || underAny(a.path, moved) || kept[a.path] || containsAny(a.path, kept) {
+			continue
+		}
+
+		var rarest []*dirNode
+		for rel, h := range a.files {
+			list := holders[rel+"\x00"+h]
+			if rarest == nil || len(list) < len(rarest) {
+				rarest = list
+			}
+		}
+
+		var best *dirNode
+		for _, b := range rarest {
+			if len(b.files) <= len(a.files) || underAny(b.path, moved) || related(a.path, b.path) {
+				continue
+			}
+			if !containsFiles(b, a) {
+				continue
+			}
+			if best == nil || len(b.files) > len(best.files) ||
+				(len(b.files) == len(best.files) && b.path < best.path) {
+				best = b
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		moved[a.path] = true
+		kept[best.path] = true
+		groups = append(groups, Group{
+			Hash:       a.merkle,
+			Keeper:     entries[best.path],
+			Duplicates: []core.FileEntry{entries[a.path]},
+			Subset:     true,
+		})
+	}
+	return groups
+}
+
+// dropNested removes duplicates that lie inside another moved directory,
+// since moving the outer one takes them along.
+func dropNested(groups []Group, moved map[string]bool) []Group {
+	var kept []Group
+	for _, g := range groups {
+		var dupes []core.FileEntry
+		for _, f := range g.Duplicates {
+			if underAny(filepath.Dir(f.SourcePath), moved) {
+				delete(moved, f.SourcePath)
+				continue
+			}
+			dupes = append(dupes, f)
+		}
+		if len(dupes) > 0 {
+			g.Duplicates = dupes
+			kept = append(kept, g)
+		}
+	}
+	return kept
+}
+
+// buildDirNodes records every file under each of its ancestor directories,
+// stopping below the scanned root.
+func buildDirNodes(files []core.FileEntry, tokens map[string]string) map[string]*dirNode {
+	nodes := make(map[string]*dirNode)
+	node := func(path, root string) *dirNode {
+		n, ok := nodes[path]
+		if !ok {
+			rel, _ := filepath.Rel(root, path)
+			n = &dirNode{
+				path:    path,
+				depth:   strings.Count(rel, string(filepath.Separator)),
+				files:   make(map[string]string),
+				direct:  make(map[string]string),
+				subdirs: make(map[string]bool),
+			}
+			nodes[path] = n
+		}
+		return n
+	}
+
+	for _, f := range files {
+		h := tokens[f.SourcePath]
+		child := f.SourcePath
+		for dir := filepath.Dir(f.SourcePath); dir != f.RootDir && isWithin(dir, f.RootDir); dir = filepath.Dir(dir) {
+			n := node(dir, f.RootDir)
+			rel, _ := filepath.Rel(dir, f.SourcePath)
+			n.files[rel] = h
+			n.size += f.Size
+			if child == f.SourcePath {
+				n.direct[filepath.Base(child)] = h
+			} else {
+				n.subdirs[filepath.Base(child)] = true
+			}
+			child = dir
+		}
+	}
+	return nodes
+}
+
+// markIncomplete flags the directories holding entries the scan left out,
+// such as hidden or ignored files, folders past the recursion limit and
+// empty folders. Their Merkle hash doesn't cover everything that moving them
+// would take along, so they are only ever kept, never moved.
+func markIncomplete(nodes map[string]*dirNode) {
+	for _, n := range nodes {
+		if n.incomplete {
+			continue
+		}
+		entries, err := os.ReadDir(n.path)
+		complete := err == nil
+		for _, e := range entries {
+			if _, ok := n.direct[e.Name()]; !ok && !n.subdirs[e.Name()] {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			continue
+		}
+		for p := n.path; nodes[p] != nil; p = filepath.Dir(p) {
+			nodes[p].incomplete = true
+		}
+	}
+}
+
+// computeMerkle hashes each directory from the names and hashes of the files
+// directly inside it and the Merkle hashes of its subdirectories, deepest
+// first, so equal hashes mean equal trees.
+func (d *DuplicateFinder) computeMerkle(nodes map[string]*dirNode) {
+	ordered := make([]*dirNode, 0, len(nodes))
+	for _, n := range nodes {
+		ordered = append(ordered, n)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].depth > ordered[j].depth })
+
+	for _, n := range ordered {
+		lines := make([]string, 0, len(n.direct)+len(n.subdirs))
+		for name, h := range n.direct {
+			lines = append(lines, fmt.Sprintf("f %q %s", name, h))
+		}
+		for name := range n.subdirs {
+			lines = append(lines, fmt.Sprintf("d %q %s", name, nodes[filepath.Join(n.path, name)].merkle))
+		}
+		sort.Strings(lines)
+		n.merkle = d.algo.Bytes([]byte(strings.Join(lines, "\n")))
+	}
+}
+
+// containsFiles reports whether every file of a exists in b at the same
+// relative path with the same content.
+func containsFiles(b, a *dirNode) bool {
+	for rel, h := range a.files {
+		if b.files[rel] != h {
+			return false
+		}
+	}
+	return true
+}
+
+func minDepth(group []*dirNode) int {
+	m := group[0].depth
+	for _, n := range group[1:] {
+		m = min(m, n.depth)
+	}
+	return m
+}
+
+// underAny reports whether path or one of its ancestors is in set.
+func underAny(path string, set map[string]bool) bool {
+	for p := path; ; {
+		if set[p] {
+			return true
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return false
+		}
+		p = parent
+	}
+}
+
+// containsAny reports whether a directory in set lies below path.
+func containsAny(path string, set map[string]bool) bool {
+	for p := range set {
+		if p != path && isWithin(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// related reports whether one of a and b contains the other.
+func related(a, b string) bool {
+	return isWithin(a, b) || isWithin(b, a)
+}
+
+// isWithin reports whether path is dir or lies below it.
+func isWithin(path, dir string) bool {
+	return within(core.FileEntry{SourcePath: path}, dir)
+}
@@ -3,17 +3,18 @@ package dupl
 import (
 	"context"
 	"crypto/sha1"
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"sync"
 
 	"github.com/electr1fy0/sorta/internal/core"
 	"github.com/electr1fy0/sorta/internal/hash"
+	"github.com/electr1fy0/sorta/internal/sniff"
 )
 
 type sizeHash struct {
@@ -26,14 +27,143 @@ type DuplicateFinder struct {
 	stats      core.DuplicateStats
 	statsMu    sync.Mutex
 	progressFn func(core.ProgressEvent)
+	keep       KeepPolicy
+	// dupeOp is what happens to each duplicate: OpDedupe moves it into
+	// duplicates/, the relink ops replace it in place.
+	dupeOp core.OperationType
+	// refs are files from reference trees. They are only ever kept, and
+	// once any are added only duplicates of them are flagged.
+	refs     []core.FileEntry
+	refPaths map[string]bool
+	// similar switches to perceptual image matching, grouping pictures
+	// whose hashes are at most maxDistance bits apart.
+	similar     bool
+	maxDistance int
+	// algo is the content hash used for partial and full hashes.
+	algo hash.Algorithm
+	// dirs compares whole directory trees instead of single files.
+	dirs bool
 }
 
 func NewDuplicateFinder() *DuplicateFinder {
 	cache, err := hash.LoadHashCache()
 	if err != nil {
+		fmt.Fprintf(os.Stderr, "hash cache disabled: %v\n", err)
 		cache = nil
 	}
-	return &DuplicateFinder{cache: cache}
+	return &DuplicateFinder{cache: cache, dupeOp: core.OpDedupe, algo: hash.DefaultAlgorithm}
+}
+
+// SetAlgorithm chooses the hash used to compare file contents.
+func (d *DuplicateFinder) SetAlgorithm(algo hash.Algorithm) {
+	d.algo = algo
+}
+
+// Algorithm reports the hash used to compare file contents.
+func (d *DuplicateFinder) Algorithm() hash.Algorithm {
+	return d.algo
+}
+
+// SetKeepPolicy chooses which copy of each duplicate group stays in place.
+func (d *DuplicateFinder) SetKeepPolicy(p KeepPolicy) {
+	d.keep = p
+}
+
+// SetLinkMode makes duplicates be replaced in place by links to their
+// keeper: "hard" for hardlinks, "reflink" for copy-on-write clones.
+func (d *DuplicateFinder) SetLinkMode(mode string) error {
+	switch mode {
+	case "":
+		d.dupeOp = core.OpDedupe
+	case "hard":
+		d.dupeOp = core.OpRelinkHard
+	case "reflink":
+		d.dupeOp = core.OpRelinkReflink
+	default:
+		return fmt.Errorf("unknown link mode %q (use hard or reflink)", mode)
+	}
+	return nil
+}
+
+// AddReferences adds the files of a reference tree. Scanned
+// files are then only flagged when their content exists in a reference
+// tree, and reference files are never moved, linked or deleted.
+func (d *DuplicateFinder) AddReferences(files []core.FileEntry) {
+	if d.refPaths == nil {
+		d.refPaths = make(map[string]bool, len(files))
+	}
+	for _, f := range files {
+		if !d.refPaths[f.SourcePath] {
+			d.refPaths[f.SourcePath] = true
+			d.refs = append(d.refs, f)
+		}
+	}
+}
+
+func (d *DuplicateFinder) isRef(f core.FileEntry) bool {
+	return d.refPaths[f.SourcePath]
+}
+
+// withReferences appends the reference files to files, dropping scanned
+// files that are references themselves (a reference tree inside the
+// scanned directory).
+func (d *DuplicateFinder) withReferences(files []core.FileEntry) []core.FileEntry {
+	if len(d.refs) == 0 {
+		return files
+	}
+	all := make([]core.FileEntry, 0, len(files)+len(d.refs))
+	for _, f := range files {
+		if !d.isRef(f) {
+			all = append(all, f)
+		}
+	}
+	return append(all, d.refs...)
+}
+
+// splitGroup picks the copy to keep from a group of identical files and
+// returns it with the copies to act on. Without references the keep policy
+// picks from the whole group. With references, groups without one are left
+// alone and the keeper is always a reference file.
+func (d *DuplicateFinder) splitGroup(group []core.FileEntry, choose func([]core.FileEntry) []core.FileEntry) (core.FileEntry, []core.FileEntry, bool) {
+	if len(d.refs) == 0 {
+		ordered := choose(group)
+		return ordered[0], ordered[1:], true
+	}
+
+	var refs, scanned []core.FileEntry
+	for _, f := range group {
+		if d.isRef(f) {
+			refs = append(refs, f)
+		} else {
+			scanned = append(scanned, f)
+		}
+	}
+	if len(refs) == 0 || len(scanned) == 0 {
+		return core.FileEntry{}, nil, false
+	}
+	sort.Slice(scanned, func(i, j int) bool { return scanned[i].SourcePath < scanned[j].SourcePath })
+	return choose(refs)[0], scanned, true
+}
+
+// worthHashing reports whether a candidate group could still produce a
+// duplicate. With references that takes at least one reference file and
+// one scanned file, which keeps large reference trees cheap to check.
+func (d *DuplicateFinder) worthHashing(group []core.FileEntry) bool {
+	if len(group) < 2 {
+		return false
+	}
+	if len(d.refs) == 0 {
+		return true
+	}
+	var hasRef, hasScanned bool
+	for _, f := range group {
+		if d.isRef(f) {
+			hasRef = true
+		} else {
+			hasScanned = true
+		}
+	}
+	return hasRef && hasScanned
 }
 
 func (d *DuplicateFinder) SetProgressReporter(fn func(core.ProgressEvent)) {
@@ -42,71 +172,157 @@ func (d *DuplicateFinder) SetProgressReporter(fn func(core.ProgressEvent)) {
 	d.progressFn = fn
 }
 
+// Group is a set of files with the same content, or with --similar-images
+// near-identical pictures, together with the copy that stays in place. In
+// directory mode the entries are directories.
+type Group struct {
+	Hash       string
+	Keeper     core.FileEntry
+	Duplicates []core.FileEntry
+	// Subset marks a directory group whose duplicate holds only part of
+	// the keeper's files rather than all of them.
+	Subset bool
+}
+
+// Reclaimable is the number of bytes freed by removing the duplicates.
+func (g Group) Reclaimable() int64 {
+	var n int64
+	for _, f := range g.Duplicates {
+		n += f.Size
+	}
+	return n
+}
+
+// Groups finds the duplicate groups among files without planning anything.
+func (d *DuplicateFinder) Groups(ctx context.Context, files []core.FileEntry) ([]Group, error) {
+	groups, _, err := d.findGroups(ctx, files)
+	return groups, err
+}
+
 func (d *DuplicateFinder) Decide(ctx context.Context, files []core.FileEntry) ([]core.FileOperation, error) {
+	groups, skipped, err := d.findGroups(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]core.FileOperation, skipped, skipped+len(files))
+	for i := range ops {
+		ops[i] = core.FileOperation{OpType: core.OpSkip}
+	}
+	for _, g := range groups {
+		ops = append(ops, core.FileOperation{OpType: core.OpSkip})
+		for _, f := range g.Duplicates {
+			if d.dupeOp != core.OpDedupe {
+				if sameFile(f.SourcePath, g.Keeper.SourcePath) {
+					ops = append(ops, core.FileOperation{OpType: core.OpSkip})
+					continue
+				}
+				ops = append(ops, core.FileOperation{
+					OpType:   d.dupeOp,
+					File:     f,
+					DestPath: g.Keeper.SourcePath,
+					Size:     f.Size,
+					Keeper:   g.Keeper.SourcePath,
+				})
+				continue
+			}
+			ops = append(ops, core.FileOperation{
+				OpType:   core.OpDedupe,
+				File:     f,
+				DestPath: DuplicatePath(f, g.Hash),
+				Keeper:   g.Keeper.SourcePath,
+			})
+		}
+	}
+	return ops, nil
+}
+
+// findGroups runs the size, partial-hash and full-hash funnel over files
+// and returns the duplicate groups, ordered by keeper, together with the
+// number of files that turned out not to be duplicates.
+func (d *DuplicateFinder) findGroups(ctx context.Context, files []core.FileEntry) ([]Group, int, error) {
+	if d.similar {
+		return d.findSimilarGroups(ctx, files)
+	}
+	if d.dirs {
+		return d.findDirGroups(ctx, files)
+	}
+
+	files = d.withReferences(files)
 	d.setFilesSeen(len(files))
 
-	validFiles, ops := filterValidFiles(files)
+	validFiles, skipped := filterValidFiles(files)
 
 	bySize := groupBySize(validFiles)
-	partialCandidates := filterSingletons(bySize, &ops)
+	partialCandidates := filterSingletons(bySize, &skipped, d.worthHashing)
 
 	partialHashes, err := d.hashFiles(ctx, partialCandidates, "partial", func(f core.FileEntry) (string, error) {
-		h, err := partialHash(f.SourcePath)
+		h, err := d.partialHash(f)
 		if err == nil {
 			d.addPartialHashed(1)
 		}
 		return h, err
 	})
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	byPartial, err := groupByHashCtx(ctx, partialCandidates, partialHashes, func(f core.FileEntry, h string) sizeHash {
 		return sizeHash{f.Size, h}
 	})
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	fullCandidates := filterSingletons(byPartial, &ops)
+	fullCandidates := filterSingletons(byPartial, &skipped, d.worthHashing)
 
 	fullHashes, err := d.hashFiles(ctx, fullCandidates, "full", d.fullHashWithCache)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	byFull, err := groupByHashCtx(ctx, fullCandidates, fullHashes, func(_ core.FileEntry, h string) string { return h })
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
+	var groups []Group
 	for contentHash, fGroup := range byFull {
 		if err := ctx.Err(); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		ops = append(ops, core.FileOperation{OpType: core.OpSkip})
-		for _, f := range fGroup[1:] {
-			ops = append(ops, core.FileOperation{
-				OpType:   core.OpDedupe,
-				File:     f,
-				DestPath: dedupeDestPath(f, contentHash),
-			})
+		if len(fGroup) < 2 {
+			skipped += len(fGroup)
+			continue
 		}
+		keeper, dupes, ok := d.splitGroup(fGroup, d.keep.Choose)
+		if !ok {
+			skipped += len(fGroup)
+			continue
+		}
+		groups = append(groups, Group{Hash: contentHash, Keeper: keeper, Duplicates: dupes})
 	}
+	sortGroups(groups)
 
 	if d.cache != nil {
 		if err := d.cache.Save(); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 	}
 
-	return ops, nil
+	return groups, skipped, nil
 }
 
-func filterSingletons[K comparable](groups map[K][]core.FileEntry, ops *[]core.FileOperation) []core.FileEntry {
+func sortGroups(groups []Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Keeper.SourcePath < groups[j].Keeper.SourcePath
+	})
+}
+
+func filterSingletons[K comparable](groups map[K][]core.FileEntry, skipped *int, keep func([]core.FileEntry) bool) []core.FileEntry {
 	var candidates []core.FileEntry
 	for _, group := range groups {
-		if len(group) == 1 {
-			*ops = append(*ops, core.FileOperation{OpType: core.OpSkip})
+		if !keep(group) {
+			*skipped += len(group)
 			continue
 		}
 		candidates = append(candidates, group...)
@@ -138,17 +354,17 @@ func groupByHashCtx[K comparable](ctx context.Context, files []core.FileEntry, h
 	return result, nil
 }
 
-func filterValidFiles(files []core.FileEntry) ([]core.FileEntry, []core.FileOperation) {
+func filterValidFiles(files []core.FileEntry) ([]core.FileEntry, int) {
 	var valid []core.FileEntry
-	var ops []core.FileOperation
+	skipped := 0
 	for _, f := range files {
-		if f.SourcePath == filepath.Join(f.RootDir, "duplicates", filepath.Base(f.SourcePath)) {
-			ops = append(ops, core.FileOperation{OpType: core.OpSkip})
+		if within(f, "duplicates") {
+			skipped++
 			continue
 		}
 		valid = append(valid, f)
 	}
-	return valid, ops
+	return valid, skipped
 }
 
 func (d *DuplicateFinder) Stats() core.DuplicateStats {
@@ -192,6 +408,16 @@ func (d *DuplicateFinder) addFullHashMiss(bytes int64) {
 	d.stats.BytesHashed += bytes
 }
 
+// addImageHashed counts a perceptual hash computed for an image. The image
+// is decoded rather than read through, so it adds no content hash or bytes
+// hashed.
+func (d *DuplicateFinder) addImageHashed() {
+	d.statsMu.Lock()
+	defer d.statsMu.Unlock()
+	d.stats.CacheMisses++
+	d.stats.ImagesHashed++
+}
+
 func (d *DuplicateFinder) fullHashWithCache(file core.FileEntry) (string, error) {
 	fp, err := hash.GetFingerprint(file.SourcePath)
 	if err != nil {
@@ -199,13 +425,13 @@ func (d *DuplicateFinder) fullHashWithCache(file core.FileEntry) (string, error)
 	}
 
 	if d.cache != nil {
-		if h, ok := d.cache.Get(file.SourcePath, fp); ok {
+		if h, ok := d.cache.Get(file.SourcePath, fp, d.algo); ok {
 			d.addCacheHit()
 			return h, nil
 		}
 	}
 
-	h, err := fullHash(file.SourcePath)
+	h, err := d.algo.Sum(file.SourcePath)
 	if err != nil {
 		return "", err
 	}
@@ -213,7 +439,7 @@ func (d *DuplicateFinder) fullHashWithCache(file core.FileEntry) (string, error)
 	d.addFullHashMiss(file.Size)
 
 	if d.cache != nil {
-		d.cache.Put(file.SourcePath, fp, h)
+		d.cache.Put(file.SourcePath, fp, d.algo, h)
 	}
 	return h, nil
 }
@@ -298,7 +524,9 @@ func (d *DuplicateFinder) hashFiles(
 	return hashed, nil
 }
 
-func dedupeDestPath(file core.FileEntry, contentHash string) string {
+// DuplicatePath returns where a duplicate of file is moved to inside the
+// duplicates folder of its root.
+func DuplicatePath(file core.FileEntry, contentHash string) string {
 	base := filepath.Base(file.SourcePath)
 	ext := filepath.Ext(base)
 	stem := base[:len(base)-len(ext)]
@@ -314,31 +542,40 @@ func dedupeDestPath(file core.FileEntry, contentHash string) string {
 	return filepath.Join(file.RootDir, "duplicates", fmt.Sprintf("%s_%s_%s%s", stem, hashPart, pathPart, ext))
 }
 
-func partialHash(path string) (string, error) {
-	f, err := os.Open(path)
+// sameFile reports whether a and b are already hardlinks of one file.
+func sameFile(a, b string) bool {
+	ia, err := os.Stat(a)
 	if err != nil {
-		return "", err
+		return false
 	}
-	defer f.Close()
-
-	buf := make([]byte, 4096)
-	n, err := io.ReadFull(f, buf)
-	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
-		return "", err
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
 	}
-	return fmt.Sprintf("%x", sha256.Sum256(buf[:n])), nil
+	return os.SameFile(ia, ib)
 }
 
-func fullHash(path string) (string, error) {
-	f, err := os.Open(path)
+// partialHash hashes the first sniff.HeadSize bytes of file. SHA-256 reuses
+// the hash sniff already took while detecting the file type.
+func (d *DuplicateFinder) partialHash(file core.FileEntry) (string, error) {
+	if d.algo == hash.SHA256 {
+		head, err := sniff.Head(file)
+		if err != nil {
+			return "", err
+		}
+		return head.Partial, nil
+	}
+
+	f, err := os.Open(file.SourcePath)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
 
-	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
+	buf := make([]byte, sniff.HeadSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 		return "", err
 	}
-	return fmt.Sprintf("%x", h.Sum(nil)), nil
+	return d.algo.Bytes(buf[:n]), nil
 }
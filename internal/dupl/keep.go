@@ -0,0 +1,135 @@
+package dupl
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/electr1fy0/sorta/internal/core"
+)
+
+type KeepRule int
+
+const (
+	KeepOldest KeepRule = iota
+	KeepNewest
+	KeepShortestPath
+	KeepLongestName
+)
+
+var keepRuleNames = map[KeepRule]string{
+	KeepOldest:       "oldest",
+	KeepNewest:       "newest",
+	KeepShortestPath: "shortest-path",
+	KeepLongestName:  "longest-name",
+}
+
+func (r KeepRule) String() string {
+	return keepRuleNames[r]
+}
+
+// KeepPolicy decides which copy in a group of duplicates stays in place.
+// Copies under a Prefer directory win over the rest, earlier entries first;
+// copies under an Avoid directory are only kept when every copy is. Within
+// the same tier Rule decides, and the path breaks any remaining tie.
+type KeepPolicy struct {
+	Rule   KeepRule
+	Prefer []string
+	Avoid  []string
+}
+
+// ParseKeepPolicy parses the value of --keep: one of the rule names, or
+// in=<dir> to prefer the copy under dir.
+func ParseKeepPolicy(s string) (KeepPolicy, error) {
+	if dir, ok := strings.CutPrefix(s, "in="); ok {
+		if strings.TrimSpace(dir) == "" {
+			return KeepPolicy{}, fmt.Errorf("keep policy in= needs a directory")
+		}
+		return KeepPolicy{Prefer: []string{strings.TrimSpace(dir)}}, nil
+	}
+	for rule, name := range keepRuleNames {
+		if name == s {
+			return KeepPolicy{Rule: rule}, nil
+		}
+	}
+	return KeepPolicy{}, fmt.Errorf("unknown keep policy %q (use oldest, newest, shortest-path, longest-name or in=<dir>)", s)
+}
+
+// AddPriority appends directories from a config @keep line. Entries
+// starting with ! are directories whose copies should not be kept.
+func (p *KeepPolicy) AddPriority(entries []string) {
+	for _, entry := range entries {
+		if dir, ok := strings.CutPrefix(entry, "!"); ok {
+			p.Avoid = append(p.Avoid, strings.TrimSpace(dir))
+		} else {
+			p.Prefer = append(p.Prefer, entry)
+		}
+	}
+}
+
+func (p KeepPolicy) String() string {
+	parts := []string{p.Rule.String()}
+	for _, dir := range p.Prefer {
+		parts = append(parts, "in="+dir)
+	}
+	for _, dir := range p.Avoid {
+		parts = append(parts, "!"+dir)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Choose orders group so the copy to keep comes first.
+func (p KeepPolicy) Choose(group []core.FileEntry) []core.FileEntry {
+	ordered := append([]core.FileEntry(nil), group...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if ta, tb := p.tier(a), p.tier(b); ta != tb {
+			return ta < tb
+		}
+		switch p.Rule {
+		case KeepOldest:
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		case KeepNewest:
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.After(b.ModTime)
+			}
+		case KeepShortestPath:
+			if la, lb := len(a.SourcePath), len(b.SourcePath); la != lb {
+				return la < lb
+			}
+		case KeepLongestName:
+			if la, lb := len(filepath.Base(a.SourcePath)), len(filepath.Base(b.SourcePath)); la != lb {
+				return la > lb
+			}
+		}
+		return a.SourcePath < b.SourcePath
+	})
+	return ordered
+}
+
+func (p KeepPolicy) tier(file core.FileEntry) int {
+	for i, dir := range p.Prefer {
+		if within(file, dir) {
+			return i
+		}
+	}
+	for _, dir := range p.Avoid {
+		if within(file, dir) {
+			return len(p.Prefer) + 1
+		}
+	}
+	return len(p.Prefer)
+}
+
+// within reports whether file lies under dir, which is either absolute or
+// relative to the file's root.
+func within(file core.FileEntry, dir string) bool {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(file.RootDir, dir)
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), file.SourcePath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
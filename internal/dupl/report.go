@@ -0,0 +1,128 @@
+package dupl
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/hash"
+)
+
+type reportGroup struct {
+	Hash        string   `json:"hash"`
+	Size        int64    `json:"size"`
+	Keeper      string   `json:"keeper"`
+	Paths       []string `json:"paths"`
+	Reclaimable int64    `json:"reclaimable"`
+	Subset      bool     `json:"subset,omitempty"`
+}
+
+type reportSummary struct {
+	Groups        int   `json:"groups"`
+	Duplicates    int   `json:"duplicates"`
+	Reclaimable   int64 `json:"reclaimable"`
+	FilesSeen     int   `json:"filesSeen"`
+	PartialHashed int   `json:"partialHashed"`
+	FullHashed    int   `json:"fullHashed"`
+	ImagesHashed  int   `json:"imagesHashed,omitempty"`
+	CacheHits     int   `json:"cacheHits"`
+	CacheMisses   int   `json:"cacheMisses"`
+	BytesHashed   int64 `json:"bytesHashed"`
+}
+
+type report struct {
+	Root      string        `json:"root"`
+	Algorithm string        `json:"algorithm"`
+	Groups    []reportGroup `json:"groups"`
+	Summary   reportSummary `json:"summary"`
+}
+
+// WriteReport writes groups found under root with algo as "json" or "csv".
+// JSON is followed by a summary built from stats; for CSV, which has one
+// row per file, WriteSummaryCSV writes it separately.
+func WriteReport(w io.Writer, format, root string, algo hash.Algorithm, groups []Group, stats core.DuplicateStats) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newReport(root, algo, groups, stats))
+	case "csv":
+		return writeCSV(w, groups)
+	}
+	return fmt.Errorf("unknown report format %q (use json or csv)", format)
+}
+
+// WriteSummaryCSV writes the summary of a CSV report as stat,value rows.
+func WriteSummaryCSV(w io.Writer, root string, algo hash.Algorithm, groups []Group, stats core.DuplicateStats) error {
+	r := newReport(root, algo, groups, stats)
+	s := r.Summary
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"stat", "value"})
+	for _, row := range [][2]string{
+		{"root", r.Root},
+		{"algorithm", r.Algorithm},
+		{"groups", strconv.Itoa(s.Groups)},
+		{"duplicates", strconv.Itoa(s.Duplicates)},
+		{"reclaimable", strconv.FormatInt(s.Reclaimable, 10)},
+		{"filesSeen", strconv.Itoa(s.FilesSeen)},
+		{"partialHashed", strconv.Itoa(s.PartialHashed)},
+		{"fullHashed", strconv.Itoa(s.FullHashed)},
+		{"imagesHashed", strconv.Itoa(s.ImagesHashed)},
+		{"cacheHits", strconv.Itoa(s.CacheHits)},
+		{"cacheMisses", strconv.Itoa(s.CacheMisses)},
+		{"bytesHashed", strconv.FormatInt(s.BytesHashed, 10)},
+	} {
+		cw.Write(row[:])
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func newReport(root string, algo hash.Algorithm, groups []Group, stats core.DuplicateStats) report {
+	r := report{Root: root, Algorithm: algo.String(), Groups: make([]reportGroup, 0, len(groups))}
+	for _, g := range groups {
+		paths := []string{g.Keeper.SourcePath}
+		for _, f := range g.Duplicates {
+			paths = append(paths, f.SourcePath)
+		}
+		r.Groups = append(r.Groups, reportGroup{
+			Hash:        g.Hash,
+			Size:        g.Keeper.Size,
+			Keeper:      g.Keeper.SourcePath,
+			Paths:       paths,
+			Reclaimable: g.Reclaimable(),
+			Subset:      g.Subset,
+		})
+		r.Summary.Duplicates += len(g.Duplicates)
+		r.Summary.Reclaimable += g.Reclaimable()
+	}
+	r.Summary.Groups = len(groups)
+	r.Summary.FilesSeen = stats.FilesSeen
+	r.Summary.PartialHashed = stats.PartialHashed
+	r.Summary.FullHashed = stats.FullHashed
+	r.Summary.ImagesHashed = stats.ImagesHashed
+	r.Summary.CacheHits = stats.CacheHits
+	r.Summary.CacheMisses = stats.CacheMisses
+	r.Summary.BytesHashed = stats.BytesHashed
+	return r
+}
+
+// writeCSV writes one row per file, with the bytes removing it would free,
+// so the reclaimable column sums to the total.
+func writeCSV(w io.Writer, groups []Group) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"group", "hash", "path", "size", "keeper", "reclaimable"})
+	for i, g := range groups {
+		id := strconv.Itoa(i + 1)
+		cw.Write([]string{id, g.Hash, g.Keeper.SourcePath, strconv.FormatInt(g.Keeper.Size, 10), "true", "0"})
+		for _, f := range g.Duplicates {
+			size := strconv.FormatInt(f.Size, 10)
+			cw.Write([]string{id, g.Hash, f.SourcePath, size, "false", size})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,166 @@
+package dupl
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/hash"
+	"github.com/electr1fy0/sorta/internal/sniff"
+)
+
+var perceptualTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// SetSimilarImages makes Decide group JPEG, PNG and GIF images whose
+// perceptual hashes differ by at most maxDistance bits, instead of files
+// with identical content.
+func (d *DuplicateFinder) SetSimilarImages(maxDistance int) {
+	d.similar = true
+	d.maxDistance = maxDistance
+}
+
+func (d *DuplicateFinder) findSimilarGroups(ctx context.Context, files []core.FileEntry) ([]Group, int, error) {
+	files = d.withReferences(files)
+	d.setFilesSeen(len(files))
+
+	validFiles, skipped := filterValidFiles(files)
+	var images []core.FileEntry
+	for _, f := range validFiles {
+		head, err := sniff.Head(f)
+		if err != nil || !perceptualTypes[head.Type] {
+			skipped++
+			continue
+		}
+		images = append(images, f)
+	}
+
+	var mu sync.Mutex
+	infos := make(map[string]hash.ImageHash, len(images))
+	_, err := d.hashFiles(ctx, images, "perceptual", func(f core.FileEntry) (string, error) {
+		info, ok := d.imageHashWithCache(f)
+		if ok {
+			mu.Lock()
+			infos[f.SourcePath] = info
+			mu.Unlock()
+		}
+		return "", nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hashed := make([]core.FileEntry, 0, len(infos))
+	for _, f := range images {
+		if _, ok := infos[f.SourcePath]; ok {
+			hashed = append(hashed, f)
+		}
+	}
+	skipped += len(images) - len(hashed)
+	sort.Slice(hashed, func(i, j int) bool { return hashed[i].SourcePath < hashed[j].SourcePath })
+
+	var groups []Group
+	grouped := 0
+	for _, g := range d.similarGroups(hashed, infos) {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, err
+		}
+		grouped += len(g.Duplicates) + 1
+		groups = append(groups, g)
+	}
+	skipped += len(hashed) - grouped
+	sortGroups(groups)
+
+	if d.cache != nil {
+		if err := d.cache.Save(); err != nil {
+			return nil, 0, err
+		}
+	}
+	return groups, skipped, nil
+}
+
+// imageHashWithCache returns the perceptual hash of f, or false if it
+// can't be decoded. Undecodable images are skipped rather than failing the
+// whole scan.
+func (d *DuplicateFinder) imageHashWithCache(f core.FileEntry) (hash.ImageHash, bool) {
+	fp, err := hash.GetFingerprint(f.SourcePath)
+	if err != nil {
+		return hash.ImageHash{}, false
+	}
+	if d.cache != nil {
+		if info, ok := d.cache.GetImage(f.SourcePath, fp); ok {
+			d.addCacheHit()
+			return info, true
+		}
+	}
+
+	info, err := hash.ImageSum(f.SourcePath)
+	if err != nil {
+		return hash.ImageHash{}, false
+	}
+	d.addImageHashed()
+	if d.cache != nil {
+		d.cache.PutImage(f.SourcePath, fp, info)
+	}
+	return info, true
+}
+
+// similarGroups groups every image with a keeper at most maxDistance bits
+// away from it. Images are taken in keep order, and each one not grouped
+// yet keeps all the ungrouped images close enough to it, so a duplicate is
+// never further than that from its keeper, however the images chain. With
+// references only reference images keep, and only scanned ones are grouped.
+func (d *DuplicateFinder) similarGroups(files []core.FileEntry, infos map[string]hash.ImageHash) []Group {
+	ordered := d.rankImages(files, infos)
+	grouped := make([]bool, len(ordered))
+	var groups []Group
+	for i, keeper := range ordered {
+		if grouped[i] || (len(d.refs) > 0 && !d.isRef(keeper)) {
+			continue
+		}
+		hk := infos[keeper.SourcePath]
+		var dupes []core.FileEntry
+		for j := i + 1; j < len(ordered); j++ {
+			f := ordered[j]
+			if grouped[j] || (len(d.refs) > 0 && d.isRef(f)) {
+				continue
+			}
+			if hk.Distance(infos[f.SourcePath]) <= d.maxDistance {
+				grouped[j] = true
+				dupes = append(dupes, f)
+			}
+		}
+		if len(dupes) == 0 {
+			continue
+		}
+		grouped[i] = true
+		groups = append(groups, Group{Hash: hk.String(), Keeper: keeper, Duplicates: dupes})
+	}
+	return groups
+}
+
+// rankImages orders a group of similar images so the one to keep comes
+// first: preferred directories from the keep policy, then the highest
+// resolution, then the largest file, then the path.
+func (d *DuplicateFinder) rankImages(group []core.FileEntry, infos map[string]hash.ImageHash) []core.FileEntry {
+	ordered := append([]core.FileEntry(nil), group...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if ta, tb := d.keep.tier(a), d.keep.tier(b); ta != tb {
+			return ta < tb
+		}
+		ia, ib := infos[a.SourcePath], infos[b.SourcePath]
+		if pa, pb := ia.Width*ia.Height, ib.Width*ib.Height; pa != pb {
+			return pa > pb
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+		return a.SourcePath < b.SourcePath
+	})
+	return ordered
+}
@@ -0,0 +1,77 @@
+package hash
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	stdhash "hash"
+	"io"
+	"os"
+)
+
+// Algorithm selects the content hash used for duplicate detection.
+type Algorithm int
+
+const (
+	XXH64 Algorithm = iota
+	SHA256
+	SHA1
+)
+
+// DefaultAlgorithm is used when neither a flag nor the config picks one.
+const DefaultAlgorithm = XXH64
+
+var algorithmNames = map[Algorithm]string{
+	XXH64:  "xxh64",
+	SHA256: "sha256",
+	SHA1:   "sha1",
+}
+
+// Algorithms lists every supported algorithm, fastest first.
+var Algorithms = []Algorithm{XXH64, SHA1, SHA256}
+
+func (a Algorithm) String() string {
+	return algorithmNames[a]
+}
+
+func ParseAlgorithm(s string) (Algorithm, error) {
+	for a, name := range algorithmNames {
+		if name == s {
+			return a, nil
+		}
+	}
+	return DefaultAlgorithm, fmt.Errorf("unknown hash algorithm %q (use xxh64, sha256 or sha1)", s)
+}
+
+func (a Algorithm) New() stdhash.Hash {
+	switch a {
+	case SHA256:
+		return sha256.New()
+	case SHA1:
+		return sha1.New()
+	}
+	return newXXH64()
+}
+
+// Bytes returns the hex hash of data.
+func (a Algorithm) Bytes(data []byte) string {
+	h := a.New()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Sum returns the hex hash of the file contents at path.
+func (a Algorithm) Sum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := a.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -4,10 +4,14 @@ import (
 	"os"
 )
 
+// FileFingerprint identifies a file's contents without reading them. Device
+// and Inode stay the same when a file is renamed or moved within a
+// filesystem, so they also find a file's cache entry under its old path.
 type FileFingerprint struct {
 	Size    int64  `json:"size"`
 	ModTime int64  `json:"modTime"`
 	Inode   uint64 `json:"inode"`
+	Device  uint64 `json:"device,omitempty"`
 }
 
 func GetFingerprint(path string) (FileFingerprint, error) {
@@ -15,10 +19,17 @@ func GetFingerprint(path string) (FileFingerprint, error) {
 	if err != nil {
 		return FileFingerprint{}, err
 	}
+	return FingerprintOf(info), nil
+}
 
+// FingerprintOf returns the fingerprint of the file info describes. Device
+// and Inode are 0 where the platform doesn't provide them.
+func FingerprintOf(info os.FileInfo) FileFingerprint {
+	dev, ino := fileIDFromFileInfo(info)
 	return FileFingerprint{
 		Size:    info.Size(),
 		ModTime: info.ModTime().UnixNano(),
-		Inode:   inodeFromFileInfo(info),
-	}, nil
+		Inode:   ino,
+		Device:  dev,
+	}
 }
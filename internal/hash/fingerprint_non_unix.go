@@ -4,6 +4,6 @@ package hash
 
 import "os"
 
-func inodeFromFileInfo(_ os.FileInfo) uint64 {
-	return 0
+func fileIDFromFileInfo(_ os.FileInfo) (dev, ino uint64) {
+	return 0, 0
 }
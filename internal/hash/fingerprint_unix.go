@@ -7,10 +7,10 @@ import (
 	"syscall"
 )
 
-func inodeFromFileInfo(info os.FileInfo) uint64 {
+func fileIDFromFileInfo(info os.FileInfo) (dev, ino uint64) {
 	stat, ok := info.Sys().(*syscall.Stat_t)
 	if !ok {
-		return 0
+		return 0, 0
 	}
-	return stat.Ino
+	return uint64(stat.Dev), stat.Ino
 }
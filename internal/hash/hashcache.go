@@ -2,28 +2,78 @@ package hash
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/journal"
 )
 
-const hashCacheFilename = "hash-cache.json"
+const (
+	hashCacheFilename       = "hash-cache.log"
+	legacyHashCacheFilename = "hash-cache.json"
+	// compactSlack is how many superseded records the log may carry beyond
+	// one per live entry before Save rewrites it.
+	compactSlack = 1024
+)
 
+// hashCacheEntry keeps one content hash per algorithm, so switching
+// algorithms never compares hashes of different kinds. Caches written before
+// algorithms were selectable only have Hash, which is always SHA-256.
 type hashCacheEntry struct {
-	Fingerprint FileFingerprint `json:"fingerprint"`
-	Hash        string          `json:"hash"`
+	Fingerprint FileFingerprint   `json:"fingerprint"`
+	Hash        string            `json:"hash,omitempty"`
+	Hashes      map[string]string `json:"hashes,omitempty"`
+	Image       *ImageHash        `json:"image,omitempty"`
+}
+
+// cacheRecord is one line of the cache log. A record without an entry
+// removes the path.
+type cacheRecord struct {
+	Path  string          `json:"path"`
+	Entry *hashCacheEntry `json:"entry,omitempty"`
 }
 
+// HashCache remembers content hashes by path and fingerprint. It lives in an
+// append-only log: Save appends only what changed during the run, and the
+// log is compacted once superseded records pile up.
 type HashCache struct {
 	mu      sync.Mutex
 	path    string
 	entries map[string]hashCacheEntry
-	dirty   bool
+	// byID finds an entry by fingerprint alone, so a file that was renamed
+	// or moved within its filesystem keeps its hashes.
+	byID    map[FileFingerprint]string
+	pending map[string]bool
+	records int
+	corrupt bool
 }
 
+// LoadHashCache opens the cache in ~/.sorta, migrating a hash-cache.json
+// from older versions. A damaged cache is reported as an error wrapping
+// journal.ErrCorrupt and left on disk untouched.
 func LoadHashCache() (*HashCache, error) {
+	cache, err := openHashCache()
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// RecoverHashCache opens the cache like LoadHashCache, but keeps whatever
+// records are still readable. If some were damaged it returns the
+// *journal.CorruptError along with the cache, and the next Save rewrites
+// the log without them.
+func RecoverHashCache() (*HashCache, error) {
+	return openHashCache()
+}
+
+func openHashCache() (*HashCache, error) {
 	sortaDir, err := core.GetSortaDir()
 	if err != nil {
 		return nil, err
@@ -36,71 +86,441 @@ func LoadHashCache() (*HashCache, error) {
 	cache := &HashCache{
 		path:    filepath.Join(sortaDir, hashCacheFilename),
 		entries: make(map[string]hashCacheEntry),
+		byID:    make(map[FileFingerprint]string),
+		pending: make(map[string]bool),
+	}
+	if err := cache.migrate(filepath.Join(sortaDir, legacyHashCacheFilename)); err != nil {
+		return nil, err
 	}
 
-	data, err := os.ReadFile(cache.path)
+	err = journal.Read(cache.path, func(payload []byte) error {
+		var rec cacheRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return err
+		}
+		cache.records++
+		if rec.Entry == nil {
+			delete(cache.entries, rec.Path)
+		} else {
+			cache.entries[rec.Path] = *rec.Entry
+		}
+		return nil
+	})
+	for path, entry := range cache.entries {
+		cache.index(path, entry)
+	}
+	var corrupt *journal.CorruptError
+	if errors.As(err, &corrupt) {
+		cache.corrupt = true
+		return cache, fmt.Errorf("hash cache: %w (run 'sorta cache verify' to repair it)", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("hash cache: %w", err)
+	}
+	return cache, nil
+}
+
+// migrate moves the entries of a hash-cache.json written by older versions
+// into the log, then removes it.
+func (c *HashCache) migrate(legacy string) error {
+	data, err := os.ReadFile(legacy)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return cache, nil
+			return nil
+		}
+		return err
+	}
+	if _, err := os.Stat(c.path); err == nil {
+		return os.Remove(legacy)
+	}
+
+	entries := make(map[string]hashCacheEntry)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("%w: %s: %v (run 'sorta cache clear' to start over)", journal.ErrCorrupt, legacy, err)
 		}
-		return nil, err
 	}
-	if len(data) == 0 {
-		return cache, nil
+	for path, entry := range entries {
+		if entry.Hash == "" {
+			continue
+		}
+		if entry.Hashes == nil {
+			entry.Hashes = make(map[string]string)
+		}
+		entry.Hashes[SHA256.String()] = entry.Hash
+		entry.Hash = ""
+		entries[path] = entry
 	}
 
-	if err := json.Unmarshal(data, &cache.entries); err != nil {
-		return cache, nil
+	c.entries = entries
+	if err := c.compact(); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", legacy, err)
 	}
+	c.entries = make(map[string]hashCacheEntry)
+	c.records = 0
+	return os.Remove(legacy)
+}
 
-	return cache, nil
+// ClearHashCache removes the cache, including a leftover hash-cache.json.
+func ClearHashCache() error {
+	sortaDir, err := core.GetSortaDir()
+	if err != nil {
+		return err
+	}
+	for _, name := range []string{hashCacheFilename, legacyHashCacheFilename} {
+		if err := os.Remove(filepath.Join(sortaDir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
 }
 
-func (c *HashCache) Get(path string, fp FileFingerprint) (string, bool) {
+func (c *HashCache) Get(path string, fp FileFingerprint, algo Algorithm) (string, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	entry, ok := c.entries[path]
+	entry, ok := c.lookup(path, fp)
 	if !ok {
 		return "", false
 	}
-	if entry.Fingerprint != fp {
+	h, ok := entry.Hashes[algo.String()]
+	if !ok || h == "" {
 		return "", false
 	}
-	return entry.Hash, true
+	return h, true
 }
 
-func (c *HashCache) Put(path string, fp FileFingerprint, hash string) {
+// GetImage returns the cached perceptual hash for path, if the file still
+// matches fp.
+func (c *HashCache) GetImage(path string, fp FileFingerprint) (ImageHash, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	prev, ok := c.entries[path]
-	if ok && prev.Fingerprint == fp && prev.Hash == hash {
+	entry, ok := c.lookup(path, fp)
+	if !ok || entry.Image == nil {
+		return ImageHash{}, false
+	}
+	return *entry.Image, true
+}
+
+func (c *HashCache) PutImage(path string, fp FileFingerprint, img ImageHash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.entries[path]
+	if entry.Fingerprint != fp {
+		entry = hashCacheEntry{Fingerprint: fp}
+	} else if entry.Image != nil && *entry.Image == img {
 		return
 	}
+	entry.Image = &img
+	c.set(path, entry)
+}
+
+func (c *HashCache) Put(path string, fp FileFingerprint, algo Algorithm, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok || entry.Fingerprint != fp {
+		entry = hashCacheEntry{Fingerprint: fp}
+	} else if entry.Hashes[algo.String()] == hash {
+		return
+	}
+	hashes := make(map[string]string, len(entry.Hashes)+1)
+	for name, h := range entry.Hashes {
+		hashes[name] = h
+	}
+	hashes[algo.String()] = hash
+	entry.Hashes = hashes
+	c.set(path, entry)
+}
+
+// Rename moves the entry for src, and for everything below it if src was a
+// directory, over to dst after the file has been moved there. Entries whose
+// file no longer matches in size and mtime are dropped instead.
+func (c *HashCache) Rename(src, dst string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	renames := make(map[string]string)
+	if info, err := os.Lstat(dst); err != nil || !info.IsDir() {
+		if _, ok := c.entries[src]; ok {
+			renames[src] = dst
+		}
+	} else {
+		// Only files are cached, so a directory means a scan for the
+		// entries below it.
+		prefix := src + string(filepath.Separator)
+		for path := range c.entries {
+			if strings.HasPrefix(path, prefix) {
+				renames[path] = filepath.Join(dst, path[len(prefix):])
+			}
+		}
+	}
+
+	for path, moved := range renames {
+		entry := c.entries[path]
+		c.remove(path)
+
+		// A move across filesystems gives the file a new inode, but it is
+		// a verified copy with the same size and mtime.
+		fp, err := GetFingerprint(moved)
+		if err != nil || fp.Size != entry.Fingerprint.Size || fp.ModTime != entry.Fingerprint.ModTime {
+			continue
+		}
+		entry.Fingerprint = fp
+		c.set(moved, entry)
+	}
+}
+
+// lookup returns the entry for path if it still matches fp. Failing that, an
+// entry recorded under another path with the same fingerprint is the same
+// file, renamed or hardlinked, and is adopted for path. The caller holds c.mu.
+func (c *HashCache) lookup(path string, fp FileFingerprint) (hashCacheEntry, bool) {
+	if entry, ok := c.entries[path]; ok && entry.Fingerprint == fp {
+		return entry, true
+	}
+	if fp.Inode == 0 {
+		return hashCacheEntry{}, false
+	}
+	other, ok := c.byID[fp]
+	if !ok || other == path {
+		return hashCacheEntry{}, false
+	}
+	entry := c.entries[other]
+	c.set(path, entry)
+	if _, err := os.Lstat(other); os.IsNotExist(err) {
+		c.remove(other)
+	}
+	return entry, true
+}
+
+// set stores entry for path. The caller holds c.mu.
+func (c *HashCache) set(path string, entry hashCacheEntry) {
+	if old, ok := c.entries[path]; ok && c.byID[old.Fingerprint] == path {
+		delete(c.byID, old.Fingerprint)
+	}
+	c.entries[path] = entry
+	c.index(path, entry)
+	c.pending[path] = true
+}
 
-	c.entries[path] = hashCacheEntry{
-		Fingerprint: fp,
-		Hash:        hash,
+// index makes entry findable by fingerprint. Without an inode, as on
+// Windows, fingerprints can't tell files apart.
+func (c *HashCache) index(path string, entry hashCacheEntry) {
+	if entry.Fingerprint.Inode != 0 {
+		c.byID[entry.Fingerprint] = path
 	}
-	c.dirty = true
 }
 
+// remove drops path from the cache. The caller holds c.mu.
+func (c *HashCache) remove(path string) {
+	entry, ok := c.entries[path]
+	if !ok {
+		return
+	}
+	if c.byID[entry.Fingerprint] == path {
+		delete(c.byID, entry.Fingerprint)
+	}
+	delete(c.entries, path)
+	c.pending[path] = true
+}
+
+// Save appends the entries changed since the cache was loaded, compacting
+// the log instead when most of it would be superseded records.
 func (c *HashCache) Save() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if !c.dirty {
+	if len(c.pending) == 0 && !c.corrupt {
 		return nil
 	}
+	if c.corrupt || c.records+len(c.pending) > 2*len(c.entries)+compactSlack {
+		return c.compact()
+	}
 
-	data, err := json.MarshalIndent(c.entries, "", "  ")
+	paths := make([]string, 0, len(c.pending))
+	for path := range c.pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	records := make([]any, 0, len(paths))
+	for _, path := range paths {
+		rec := cacheRecord{Path: path}
+		if entry, ok := c.entries[path]; ok {
+			rec.Entry = &entry
+		}
+		records = append(records, rec)
+	}
+
+	w, err := journal.OpenWriter(c.path)
 	if err != nil {
 		return err
 	}
-	if err := core.WriteFileAtomic(c.path, data, 0644); err != nil {
+	if err := w.Append(records...); err != nil {
+		w.Close()
 		return err
 	}
-	c.dirty = false
+	if err := w.Close(); err != nil {
+		return err
+	}
+	c.records += len(records)
+	clear(c.pending)
+	return nil
+}
+
+// Compact rewrites the log with one record per live entry.
+func (c *HashCache) Compact() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.compact()
+}
+
+func (c *HashCache) compact() error {
+	paths := make([]string, 0, len(c.entries))
+	for path := range c.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	err := journal.Rewrite(c.path, func(w *journal.Writer) error {
+		const batch = 512
+		for start := 0; start < len(paths); start += batch {
+			records := make([]any, 0, batch)
+			for _, path := range paths[start:min(start+batch, len(paths))] {
+				entry := c.entries[path]
+				records = append(records, cacheRecord{Path: path, Entry: &entry})
+			}
+			if err := w.Append(records...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	c.records = len(paths)
+	c.corrupt = false
+	clear(c.pending)
 	return nil
 }
+
+// CacheStats describes the cache as it is on disk.
+type CacheStats struct {
+	Path        string
+	Entries     int
+	Records     int
+	Bytes       int64
+	Images      int
+	ByAlgorithm map[string]int
+}
+
+func (c *HashCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := CacheStats{
+		Path:        c.path,
+		Entries:     len(c.entries),
+		Records:     c.records,
+		ByAlgorithm: make(map[string]int),
+	}
+	if info, err := os.Stat(c.path); err == nil {
+		stats.Bytes = info.Size()
+	}
+	for _, entry := range c.entries {
+		for name := range entry.Hashes {
+			stats.ByAlgorithm[name]++
+		}
+		if entry.Image != nil {
+			stats.Images++
+		}
+	}
+	return stats
+}
+
+// Prune drops entries whose file is gone or has changed since it was
+// hashed, then compacts the log. It returns how many entries were dropped.
+func (c *HashCache) Prune() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for path, entry := range c.entries {
+		fp, err := GetFingerprint(path)
+		if err != nil || fp != entry.Fingerprint {
+			c.remove(path)
+			removed++
+		}
+	}
+	return removed, c.compact()
+}
+
+// VerifyResult lists the entries Verify found to be wrong.
+type VerifyResult struct {
+	Checked int
+	// Stale entries belong to files that are gone or have changed; prune
+	// removes them.
+	Stale []string
+	// Mismatched entries still match their file's fingerprint but hold a
+	// hash the file doesn't have.
+	Mismatched []string
+}
+
+// Verify rehashes every file whose fingerprint still matches its entry and
+// compares the result with each cached hash. Mismatched entries are dropped
+// from the cache; Save persists that.
+func (c *HashCache) Verify(progress func(done, total int)) VerifyResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	paths := make([]string, 0, len(c.entries))
+	for path := range c.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var res VerifyResult
+	for i, path := range paths {
+		if progress != nil {
+			progress(i, len(paths))
+		}
+		entry := c.entries[path]
+		fp, err := GetFingerprint(path)
+		if err != nil || fp != entry.Fingerprint {
+			res.Stale = append(res.Stale, path)
+			continue
+		}
+		res.Checked++
+		if !entryMatches(path, entry) {
+			res.Mismatched = append(res.Mismatched, path)
+			c.remove(path)
+		}
+	}
+	if progress != nil {
+		progress(len(paths), len(paths))
+	}
+	return res
+}
+
+func entryMatches(path string, entry hashCacheEntry) bool {
+	for name, want := range entry.Hashes {
+		algo, err := ParseAlgorithm(name)
+		if err != nil {
+			return false
+		}
+		got, err := algo.Sum(path)
+		if err != nil || got != want {
+			return false
+		}
+	}
+	if entry.Image != nil {
+		img, err := ImageSum(path)
+		if err != nil || img != *entry.Image {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package hash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"os"
+)
+
+// maxImagePixels caps the size of an image ImageSum will decode, about
+// 134 megapixels, since decoding allocates memory for every pixel.
+const maxImagePixels = 1 << 27
+
+// ImageHash is a perceptual hash of a decoded image together with its
+// dimensions. Resized or re-encoded copies of a picture hash to values a
+// small Hamming distance apart.
+type ImageHash struct {
+	Hash   uint64 `json:"hash"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Distance is the number of bits by which two image hashes differ.
+func (h ImageHash) Distance(o ImageHash) int {
+	return bits.OnesCount64(h.Hash ^ o.Hash)
+}
+
+func (h ImageHash) String() string {
+	return fmt.Sprintf("%016x", h.Hash)
+}
+
+// ImageSum decodes the JPEG, PNG or GIF at path and returns its dHash: the
+// image is shrunk to 9x8 grayscale cells and each bit records whether a
+// cell is darker than its right-hand neighbour.
+func ImageSum(path string) (ImageHash, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ImageHash{}, err
+	}
+	defer f.Close()
+
+	// The header gives the dimensions, so a small file claiming a huge
+	// image is refused before anything is allocated for it.
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return ImageHash{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return ImageHash{}, fmt.Errorf("decode %s: %dx%d image is too large", path, cfg.Width, cfg.Height)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return ImageHash{}, err
+	}
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return ImageHash{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return ImageHash{}, fmt.Errorf("decode %s: empty image", path)
+	}
+
+	const cols, rows = 9, 8
+	var cells [rows][cols]float64
+	for y := range rows {
+		y0, y1 := span(b.Min.Y, b.Dy(), y, rows)
+		for x := range cols {
+			x0, x1 := span(b.Min.X, b.Dx(), x, cols)
+			cells[y][x] = meanLuma(img, x0, x1, y0, y1)
+		}
+	}
+
+	var sum uint64
+	for y := range rows {
+		for x := range cols - 1 {
+			sum <<= 1
+			if cells[y][x] < cells[y][x+1] {
+				sum |= 1
+			}
+		}
+	}
+	return ImageHash{Hash: sum, Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+// span returns the pixel range covered by cell i of n along an axis that
+// starts at origin and is size pixels long.
+func span(origin, size, i, n int) (int, int) {
+	start := origin + i*size/n
+	end := origin + (i+1)*size/n
+	if end <= start {
+		end = start + 1
+	}
+	return start, end
+}
+
+// meanLuma averages the luminance over a cell, sampling at most 16x16
+// pixels so large photos stay cheap.
+func meanLuma(img image.Image, x0, x1, y0, y1 int) float64 {
+	stepX := max(1, (x1-x0)/16)
+	stepY := max(1, (y1-y0)/16)
+	var total float64
+	var n int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			total += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return total / float64(n)
+}
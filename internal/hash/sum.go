@@ -0,0 +1,7 @@
+package hash
+
+// FileSum returns the hex SHA-256 of the file contents at path. It is what
+// copies are verified with, independent of the duplicate-detection hash.
+func FileSum(path string) (string, error) {
+	return SHA256.Sum(path)
+}
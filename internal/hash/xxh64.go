@@ -0,0 +1,125 @@
+package hash
+
+import (
+	"encoding/binary"
+	stdhash "hash"
+	"math/bits"
+)
+
+// XXH64 with seed 0, a fast non-cryptographic hash. It is good enough to
+// tell files apart, which is all duplicate detection needs, and several
+// times faster than SHA-256.
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	buf   [32]byte
+	n     int
+}
+
+func newXXH64() stdhash.Hash64 {
+	d := &xxh64{}
+	d.Reset()
+	return d
+}
+
+func (d *xxh64) Reset() {
+	p1, p2 := xxPrime1, xxPrime2
+	d.v = [4]uint64{p1 + p2, p2, 0, -p1}
+	d.total = 0
+	d.n = 0
+}
+
+func (d *xxh64) Size() int      { return 8 }
+func (d *xxh64) BlockSize() int { return 32 }
+
+func (d *xxh64) Write(p []byte) (int, error) {
+	written := len(p)
+	d.total += uint64(written)
+
+	if d.n+len(p) < 32 {
+		d.n += copy(d.buf[d.n:], p)
+		return written, nil
+	}
+	if d.n > 0 {
+		c := copy(d.buf[d.n:], p)
+		d.blocks(d.buf[:])
+		p = p[c:]
+		d.n = 0
+	}
+	full := len(p) - len(p)%32
+	d.blocks(p[:full])
+	d.n = copy(d.buf[:], p[full:])
+	return written, nil
+}
+
+func (d *xxh64) blocks(p []byte) {
+	v1, v2, v3, v4 := d.v[0], d.v[1], d.v[2], d.v[3]
+	for ; len(p) >= 32; p = p[32:] {
+		v1 = xxRound(v1, binary.LittleEndian.Uint64(p[0:8]))
+		v2 = xxRound(v2, binary.LittleEndian.Uint64(p[8:16]))
+		v3 = xxRound(v3, binary.LittleEndian.Uint64(p[16:24]))
+		v4 = xxRound(v4, binary.LittleEndian.Uint64(p[24:32]))
+	}
+	d.v = [4]uint64{v1, v2, v3, v4}
+}
+
+func (d *xxh64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		v1, v2, v3, v4 := d.v[0], d.v[1], d.v[2], d.v[3]
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMerge(h, v1)
+		h = xxMerge(h, v2)
+		h = xxMerge(h, v3)
+		h = xxMerge(h, v4)
+	} else {
+		h = xxPrime5
+	}
+	h += d.total
+
+	p := d.buf[:d.n]
+	for ; len(p) >= 8; p = p[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(p))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(p) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(p)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		p = p[4:]
+	}
+	for _, b := range p {
+		h ^= uint64(b) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (d *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMerge(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
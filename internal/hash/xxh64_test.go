@@ -0,0 +1,77 @@
+package hash
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+	}
+	for _, tt := range tests {
+		d := newXXH64()
+		d.Write([]byte(tt.in))
+		if got := d.Sum64(); got != tt.want {
+			t.Errorf("xxh64(%q) = %016x, want %016x", tt.in, got, tt.want)
+		}
+		if got, want := XXH64.Bytes([]byte(tt.in)), fmt.Sprintf("%016x", tt.want); got != want {
+			t.Errorf("XXH64.Bytes(%q) = %s, want %s", tt.in, got, want)
+		}
+	}
+}
+
+// TestXXH64Streaming writes inputs around the 32-byte stripe in chunks that
+// split stripes at every offset, and expects the one-shot hash each time.
+func TestXXH64Streaming(t *testing.T) {
+	data := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 8))
+	for _, n := range []int{31, 32, 33, 63, 64, 65, len(data)} {
+		in := data[:n]
+		whole := newXXH64()
+		whole.Write(in)
+		want := whole.Sum64()
+
+		for chunk := 1; chunk <= 33; chunk++ {
+			d := newXXH64()
+			for p := in; len(p) > 0; {
+				k := min(chunk, len(p))
+				d.Write(p[:k])
+				p = p[k:]
+			}
+			if got := d.Sum64(); got != want {
+				t.Errorf("len %d in chunks of %d: got %016x, want %016x", n, chunk, got, want)
+			}
+		}
+
+		d := newXXH64()
+		d.Write(in)
+		d.Reset()
+		d.Write(in)
+		if got := d.Sum64(); got != want {
+			t.Errorf("len %d after Reset: got %016x, want %016x", n, got, want)
+		}
+	}
+}
+
+func TestXXH64Sum(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 100))
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := XXH64.Sum(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := XXH64.Bytes(data); got != want {
+		t.Errorf("XXH64.Sum = %s, want %s", got, want)
+	}
+}
@@ -11,7 +11,8 @@ import (
 )
 
 type IgnoreMatcher struct {
-	rules []IgnoreRule
+	rules    []IgnoreRule
+	excluded []string
 }
 
 type IgnoreRule struct {
@@ -23,17 +24,7 @@ func LoadIgnoreMatcher(rootDir string, inlinePatterns []string) (*IgnoreMatcher,
 	rules := make([]IgnoreRule, 0, len(inlinePatterns)+16)
 	rules = append(rules, sanitizeInlinePatterns(inlinePatterns)...)
 
-	paths := []string{
-		filepath.Join(rootDir, ".sortaignore"),
-		filepath.Join(rootDir, ".sorta", "ignore"),
-	}
-
-	sortaDir, err := core.GetSortaDir()
-	if err == nil {
-		paths = append(paths, filepath.Join(sortaDir, "ignore"))
-	}
-
-	for _, p := range paths {
+	for _, p := range Files(rootDir) {
 		lines, err := readIgnoreFile(p)
 		if err != nil {
 			return nil, err
@@ -45,13 +36,51 @@ func LoadIgnoreMatcher(rootDir string, inlinePatterns []string) (*IgnoreMatcher,
 	return &IgnoreMatcher{rules: rules}, nil
 }
 
+// Files lists the ignore files consulted for rootDir, whether or not they
+// exist.
+func Files(rootDir string) []string {
+	paths := []string{
+		filepath.Join(rootDir, ".sortaignore"),
+		filepath.Join(rootDir, ".sorta", "ignore"),
+	}
+
+	sortaDir, err := core.GetSortaDir()
+	if err == nil {
+		paths = append(paths, filepath.Join(sortaDir, "ignore"))
+	}
+	return paths
+}
+
 func (m *IgnoreMatcher) Match(rootDir, candidatePath string, isDir bool) bool {
 	_, ok := m.Explain(rootDir, candidatePath, isDir)
 	return ok
 }
 
+// ExcludeDir ignores dir and everything below it regardless of the rules,
+// e.g. a sort destination that lives inside the scanned directory. A dir
+// that isn't strictly inside the root being matched against, such as a
+// destination that holds the scanned directory, is left out of account.
+func (m *IgnoreMatcher) ExcludeDir(dir string) {
+	m.excluded = append(m.excluded, filepath.Clean(dir))
+}
+
 func (m *IgnoreMatcher) Explain(rootDir, candidatePath string, isDir bool) (IgnoreRule, bool) {
-	if m == nil || len(m.rules) == 0 {
+	if m == nil {
+		return IgnoreRule{}, false
+	}
+
+	candidate := filepath.Clean(candidatePath)
+	root := filepath.Clean(rootDir) + string(filepath.Separator)
+	for _, dir := range m.excluded {
+		if !strings.HasPrefix(dir, root) {
+			continue
+		}
+		if candidate == dir || strings.HasPrefix(candidate, dir+string(filepath.Separator)) {
+			return IgnoreRule{Pattern: dir, Source: "excluded directory"}, true
+		}
+	}
+
+	if len(m.rules) == 0 {
 		return IgnoreRule{}, false
 	}
 
@@ -0,0 +1,285 @@
+// Package journal stores append-only logs of JSON records. Each record is a
+// line holding a CRC-32 of its payload followed by the payload, so damaged
+// records are detected and skipped instead of taking the whole log with them.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrCorrupt is wrapped by every error reporting damaged records.
+var ErrCorrupt = errors.New("corrupt journal")
+
+// CorruptError lists the records of a journal that failed their checksum.
+// The readable records around them are still delivered.
+type CorruptError struct {
+	Path  string
+	Lines []int
+}
+
+func (e *CorruptError) Error() string {
+	shown := e.Lines[:min(len(e.Lines), 5)]
+	lines := make([]string, 0, len(shown)+1)
+	for _, l := range shown {
+		lines = append(lines, strconv.Itoa(l))
+	}
+	if len(e.Lines) > len(shown) {
+		lines = append(lines, "...")
+	}
+	return fmt.Sprintf("%s: %d corrupt records (lines %s)", e.Path, len(e.Lines), strings.Join(lines, ", "))
+}
+
+func (e *CorruptError) Unwrap() error {
+	return ErrCorrupt
+}
+
+// Encode returns v as a single journal record, including the newline.
+func Encode(v any) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	rec := make([]byte, 0, len(payload)+10)
+	rec = fmt.Appendf(rec, "%08x ", crc32.ChecksumIEEE(payload))
+	rec = append(rec, payload...)
+	return append(rec, '\n'), nil
+}
+
+// decode checks a record line, without its newline, and returns the payload.
+func decode(line []byte) ([]byte, bool) {
+	if len(line) < 9 || line[8] != ' ' {
+		return nil, false
+	}
+	sum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil {
+		return nil, false
+	}
+	payload := line[9:]
+	return payload, crc32.ChecksumIEEE(payload) == uint32(sum)
+}
+
+// Record is a line of a journal as found by Scan.
+type Record struct {
+	// Offset and End delimit the record in the file, newline included.
+	Offset, End int64
+	Line        int
+	Payload     []byte
+	// OK is false for a damaged record.
+	OK bool
+}
+
+// Scan calls fn with every complete record in the journal at path, damaged
+// ones included, in order. A missing journal has no records. A final record
+// without its newline was cut short by a crash mid-append and is left out.
+func Scan(path string, fn func(r Record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rec := Record{Offset: offset, End: offset + int64(len(line)), Line: lineNo}
+		offset = rec.End
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			continue
+		}
+		rec.Payload, rec.OK = decode(line)
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+}
+
+// Read calls fn with the payload of every intact record in the journal at
+// path, in order. A missing journal has no records, and a torn final record
+// is dropped silently; any other damaged record is skipped and reported
+// through a *CorruptError once the whole journal has been read.
+func Read(path string, fn func(payload []byte) error) error {
+	var bad []int
+	err := Scan(path, func(r Record) error {
+		if !r.OK {
+			bad = append(bad, r.Line)
+			return nil
+		}
+		if err := fn(r.Payload); err != nil {
+			return fmt.Errorf("%s line %d: %w", path, r.Line, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(bad) > 0 {
+		return &CorruptError{Path: path, Lines: bad}
+	}
+	return nil
+}
+
+// ReadRecord returns the payload of the record between offset and end, as
+// reported by Scan or AppendAt.
+func ReadRecord(path string, offset, end int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, end-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil {
+		return nil, err
+	}
+	payload, ok := decode(bytes.TrimSuffix(buf, []byte{'\n'}))
+	if !ok {
+		return nil, fmt.Errorf("%s at offset %d: %w", path, offset, ErrCorrupt)
+	}
+	return payload, nil
+}
+
+// Writer appends records to a journal.
+type Writer struct {
+	f *os.File
+}
+
+// OpenWriter opens the journal at path for appending, creating it if
+// needed. A record left incomplete by a crash is cut off first, so new
+// records start on a line of their own.
+func OpenWriter(path string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := trimTornTail(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to repair %s: %w", path, err)
+	}
+	return &Writer{f: f}, nil
+}
+
+// Append writes records in a single write, so concurrent writers using
+// O_APPEND never interleave within a batch.
+func (w *Writer) Append(records ...any) error {
+	_, _, err := w.AppendAt(records...)
+	return err
+}
+
+// AppendAt is Append, also returning where in the file the batch landed.
+func (w *Writer) AppendAt(records ...any) (offset, end int64, err error) {
+	var buf []byte
+	for _, v := range records {
+		rec, err := Encode(v)
+		if err != nil {
+			return 0, 0, err
+		}
+		buf = append(buf, rec...)
+	}
+	if _, err := w.f.Write(buf); err != nil {
+		return 0, 0, err
+	}
+	end, err = w.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	return end - int64(len(buf)), end, nil
+}
+
+// Sync flushes the records appended so far to disk.
+func (w *Writer) Sync() error {
+	return w.f.Sync()
+}
+
+// Close flushes the journal to disk and closes it.
+func (w *Writer) Close() error {
+	syncErr := w.f.Sync()
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+// Rewrite replaces the journal at path with the records fn appends. The new
+// journal is built next to the old one and renamed over it once synced, so
+// a crash leaves either the old records or the new ones.
+func Rewrite(path string, fn func(w *Writer) error) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	w := &Writer{f: tmp}
+	if err := fn(w); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// trimTornTail truncates f after its last newline.
+func trimTornTail(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+	if end == 0 {
+		return nil
+	}
+
+	buf := make([]byte, 64*1024)
+	for pos := end; pos > 0; {
+		n := int64(len(buf))
+		if pos < n {
+			n = pos
+		}
+		pos -= n
+		if _, err := f.ReadAt(buf[:n], pos); err != nil && err != io.EOF {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			if cut := pos + int64(i) + 1; cut != end {
+				return f.Truncate(cut)
+			}
+			return nil
+		}
+	}
+	return f.Truncate(0)
+}
@@ -0,0 +1,222 @@
+package ops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/dupl"
+	"github.com/electr1fy0/sorta/internal/hash"
+)
+
+// incumbent is whatever already holds a destination path: a file on disk,
+// or the source of an earlier planned operation that targets the same path.
+type incumbent struct {
+	path    string
+	size    int64
+	modTime time.Time
+	isDir   bool
+	planned int
+}
+
+// resolveConflicts makes every planned destination unique. Operations are
+// visited in their deterministic order, so the first one to claim a path
+// keeps it unless the operation's conflict policy says otherwise.
+func resolveConflicts(operations []core.FileOperation) error {
+	claimed := make(map[string]int, len(operations))
+	for i, op := range operations {
+		if movesFile(op) && filepath.Clean(op.DestPath) == filepath.Clean(op.File.SourcePath) {
+			claimed[filepath.Clean(op.DestPath)] = i
+		}
+	}
+
+	for i, op := range operations {
+		if !movesFile(op) {
+			continue
+		}
+		dest := filepath.Clean(op.DestPath)
+		if dest == filepath.Clean(op.File.SourcePath) {
+			continue
+		}
+
+		inc, taken, err := incumbentAt(operations, dest, claimed)
+		if err != nil {
+			return err
+		}
+		if !taken {
+			claimed[dest] = i
+			continue
+		}
+		if err := resolveConflict(operations, i, inc, claimed); err != nil {
+			return fmt.Errorf("resolving conflict for %s: %w", op.File.SourcePath, err)
+		}
+	}
+	return nil
+}
+
+func movesFile(op core.FileOperation) bool {
+	switch op.OpType {
+	case core.OpMove, core.OpRename, core.OpDedupe, core.OpCopy, core.OpSymlink, core.OpHardlink:
+		return op.DestPath != ""
+	}
+	return false
+}
+
+func incumbentAt(operations []core.FileOperation, dest string, claimed map[string]int) (incumbent, bool, error) {
+	if j, ok := claimed[dest]; ok {
+		other := operations[j]
+		inc := incumbent{path: other.File.SourcePath, size: other.File.Size, modTime: other.File.ModTime, planned: j}
+		if filepath.Clean(other.File.SourcePath) == dest {
+			inc.planned = -1
+		}
+		return inc, true, nil
+	}
+
+	info, err := os.Lstat(dest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return incumbent{}, false, nil
+		}
+		return incumbent{}, false, err
+	}
+	return incumbent{path: dest, size: info.Size(), modTime: info.ModTime(), isDir: info.IsDir(), planned: -1}, true, nil
+}
+
+func resolveConflict(operations []core.FileOperation, i int, inc incumbent, claimed map[string]int) error {
+	op := &operations[i]
+
+	// A copy or link leaves its source in place, so sorting again finds
+	// the one made last time at the destination. That one is kept.
+	if createsCopy(op.OpType) && inc.planned < 0 && !inc.isDir {
+		present, err := alreadyPlaced(op.File.SourcePath, inc.path)
+		if err != nil {
+			return err
+		}
+		if present {
+			op.OpType = core.OpSkip
+			op.Resolution = core.ResolvePresent
+			return nil
+		}
+	}
+
+	switch op.Conflict {
+	case core.ConflictSkip:
+		skipConflict(op)
+		return nil
+
+	case core.ConflictKeepNewer, core.ConflictKeepLarger:
+		wins := op.File.ModTime.After(inc.modTime)
+		if op.Conflict == core.ConflictKeepLarger {
+			wins = op.File.Size > inc.size
+		}
+		if !wins {
+			skipConflict(op)
+			return nil
+		}
+		if inc.isDir {
+			break
+		}
+		if inc.planned >= 0 {
+			// Whatever the beaten operation had to do to take the path,
+			// such as replacing a file on disk, now falls to this one.
+			op.Resolution = operations[inc.planned].Resolution
+			skipConflict(&operations[inc.planned])
+		} else {
+			op.Resolution = core.ResolveReplaced
+		}
+		claimed[filepath.Clean(op.DestPath)] = i
+		return nil
+
+	case core.ConflictDedupe:
+		if inc.isDir || inc.size != op.File.Size {
+			break
+		}
+		srcSum, err := hash.FileSum(op.File.SourcePath)
+		if err != nil {
+			return err
+		}
+		incSum, err := hash.FileSum(inc.path)
+		if err != nil {
+			return err
+		}
+		if srcSum != incSum {
+			break
+		}
+		if createsCopy(op.OpType) {
+			// The copy or link would add nothing; leave the source be.
+			op.OpType = core.OpSkip
+			op.Resolution = core.ResolveDeduped
+			return nil
+		}
+		op.OpType = core.OpDedupe
+		op.Resolution = core.ResolveDeduped
+		op.DestPath = freePath(dupl.DuplicatePath(op.File, srcSum), claimed)
+		claimed[op.DestPath] = i
+		return nil
+	}
+
+	op.DestPath = freePath(op.DestPath, claimed)
+	op.Resolution = core.ResolveSuffixed
+	claimed[op.DestPath] = i
+	return nil
+}
+
+// alreadyPlaced reports whether dest is src under another name: the same
+// file, a symlink to it, or a byte-identical copy.
+func alreadyPlaced(src, dest string) (bool, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	destInfo, err := os.Stat(dest)
+	if err != nil {
+		// A dangling symlink or similar is something else.
+		return false, nil
+	}
+	if os.SameFile(srcInfo, destInfo) {
+		return true, nil
+	}
+	if !srcInfo.Mode().IsRegular() || !destInfo.Mode().IsRegular() || srcInfo.Size() != destInfo.Size() {
+		return false, nil
+	}
+	srcSum, err := hash.FileSum(src)
+	if err != nil {
+		return false, err
+	}
+	destSum, err := hash.FileSum(dest)
+	if err != nil {
+		return false, err
+	}
+	return srcSum == destSum, nil
+}
+
+func skipConflict(op *core.FileOperation) {
+	op.OpType = core.OpSkip
+	op.Resolution = core.ResolveSkipped
+}
+
+// freePath returns dest, or the first "name (N).ext" variant of it that is
+// neither on disk nor claimed by another planned operation.
+func freePath(dest string, claimed map[string]int) string {
+	dest = filepath.Clean(dest)
+	if _, ok := claimed[dest]; !ok {
+		if _, err := os.Lstat(dest); os.IsNotExist(err) {
+			return dest
+		}
+	}
+
+	dir, base := filepath.Split(dest)
+	ext := filepath.Ext(base)
+	stem := base[:len(base)-len(ext)]
+	for n := 2; ; n++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, n, ext))
+		if _, ok := claimed[candidate]; ok {
+			continue
+		}
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package ops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/electr1fy0/sorta/internal/core"
+)
+
+func TestResolveConflicts(t *testing.T) {
+	day := func(n int) time.Time { return time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC) }
+	type src struct {
+		name string
+		mod  time.Time
+		size int
+	}
+	type want struct {
+		op   core.OperationType
+		res  core.Resolution
+		dest string
+	}
+	tests := []struct {
+		name   string
+		policy core.ConflictPolicy
+		// onDisk, if set, already holds docs/r.txt with that mtime.
+		onDisk time.Time
+		srcs   []src
+		want   []want
+	}{
+		{
+			name:   "disk incumbent loses",
+			policy: core.ConflictKeepNewer,
+			onDisk: day(1),
+			srcs:   []src{{"a/r.txt", day(2), 1}},
+			want:   []want{{core.OpMove, core.ResolveReplaced, "docs/r.txt"}},
+		},
+		{
+			name:   "disk incumbent wins",
+			policy: core.ConflictKeepNewer,
+			onDisk: day(3),
+			srcs:   []src{{"a/r.txt", day(2), 1}},
+			want:   []want{{core.OpSkip, core.ResolveSkipped, "docs/r.txt"}},
+		},
+		{
+			name:   "planned incumbent loses",
+			policy: core.ConflictKeepNewer,
+			srcs:   []src{{"a/r.txt", day(1), 1}, {"b/r.txt", day(2), 1}},
+			want: []want{
+				{core.OpSkip, core.ResolveSkipped, "docs/r.txt"},
+				{core.OpMove, core.ResolveNone, "docs/r.txt"},
+			},
+		},
+		{
+			name:   "chained incumbents",
+			policy: core.ConflictKeepNewer,
+			onDisk: day(1),
+			srcs:   []src{{"a/r.txt", day(2), 1}, {"b/r.txt", day(3), 1}},
+			want: []want{
+				{core.OpSkip, core.ResolveSkipped, "docs/r.txt"},
+				{core.OpMove, core.ResolveReplaced, "docs/r.txt"},
+			},
+		},
+		{
+			name:   "chained incumbents, later one loses",
+			policy: core.ConflictKeepNewer,
+			onDisk: day(1),
+			srcs:   []src{{"a/r.txt", day(3), 1}, {"b/r.txt", day(2), 1}},
+			want: []want{
+				{core.OpMove, core.ResolveReplaced, "docs/r.txt"},
+				{core.OpSkip, core.ResolveSkipped, "docs/r.txt"},
+			},
+		},
+		{
+			name:   "chained incumbents by size",
+			policy: core.ConflictKeepLarger,
+			onDisk: day(1),
+			srcs:   []src{{"a/r.txt", day(1), 5}, {"b/r.txt", day(1), 9}},
+			want: []want{
+				{core.OpSkip, core.ResolveSkipped, "docs/r.txt"},
+				{core.OpMove, core.ResolveReplaced, "docs/r.txt"},
+			},
+		},
+		{
+			name:   "suffix",
+			policy: core.ConflictSuffix,
+			onDisk: day(1),
+			srcs:   []src{{"a/r.txt", day(2), 1}, {"b/r.txt", day(3), 1}},
+			want: []want{
+				{core.OpMove, core.ResolveSuffixed, "docs/r (2).txt"},
+				{core.OpMove, core.ResolveSuffixed, "docs/r (3).txt"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dest := filepath.Join(root, "docs", "r.txt")
+			if !tt.onDisk.IsZero() {
+				writeFile(t, dest, 3, tt.onDisk)
+			}
+			var operations []core.FileOperation
+			for _, s := range tt.srcs {
+				path := filepath.Join(root, s.name)
+				writeFile(t, path, s.size, s.mod)
+				operations = append(operations, core.FileOperation{
+					OpType:   core.OpMove,
+					File:     core.FileEntry{RootDir: root, SourcePath: path, Size: int64(s.size), ModTime: s.mod},
+					DestPath: dest,
+					Conflict: tt.policy,
+				})
+			}
+
+			if err := resolveConflicts(operations); err != nil {
+				t.Fatal(err)
+			}
+			for i, w := range tt.want {
+				op := operations[i]
+				rel, _ := filepath.Rel(root, op.DestPath)
+				if op.OpType != w.op || op.Resolution != w.res || rel != w.dest {
+					t.Errorf("op %d: got %v %v %s, want %v %v %s", i, op.OpType, op.Resolution, rel, w.op, w.res, w.dest)
+				}
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path string, size int, mod time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
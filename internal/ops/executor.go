@@ -6,15 +6,23 @@ import (
 	"path/filepath"
 
 	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/hash"
+	"github.com/electr1fy0/sorta/internal/trash"
 )
 
 type Executor struct {
 	Operations []core.FileOperation
+	// DestRoot is recorded in history when files are sorted into a
+	// directory other than the one being scanned.
+	DestRoot string
+	// Cache, if set, follows moved files to their new paths so their hashes
+	// don't have to be recomputed. ApplyOperationsCtx saves it.
+	Cache *hash.HashCache
 }
 
 func (e *Executor) Execute(op core.FileOperation) (bool, error) {
 	switch op.OpType {
-	case core.OpMove, core.OpDedupe, core.OpRename:
+	case core.OpMove, core.OpDedupe, core.OpRename, core.OpCopy, core.OpSymlink, core.OpHardlink:
 		if op.DestPath == op.File.SourcePath {
 			return false, nil
 		}
@@ -23,15 +31,27 @@ func (e *Executor) Execute(op core.FileOperation) (bool, error) {
 		if err := os.MkdirAll(destDir, 0755); err != nil {
 			return false, fmt.Errorf("failed to create directory: %w", err)
 		}
-		if err := os.Rename(op.File.SourcePath, op.DestPath); err != nil {
-			return false, fmt.Errorf("failed to move file: %w", err)
+		if _, err := os.Lstat(op.DestPath); err == nil {
+			return false, fmt.Errorf("failed to %s file: %s: %w", verb(op.OpType), op.DestPath, os.ErrExist)
+		}
+		if err := place(op); err != nil {
+			return false, fmt.Errorf("failed to %s file: %w", verb(op.OpType), err)
+		}
+		if e.Cache != nil && !createsCopy(op.OpType) {
+			e.Cache.Rename(op.File.SourcePath, op.DestPath)
 		}
 
 		e.Operations = append(e.Operations, op)
 		return true, nil
 
 	case core.OpDelete:
-		if err := os.Remove(op.File.SourcePath); err != nil {
+		if PermanentDelete {
+			if err := os.Remove(op.File.SourcePath); err != nil {
+				return false, fmt.Errorf("failed to delete file: %w", err)
+			}
+			return true, nil
+		}
+		if _, err := trash.Put(op.File.SourcePath); err != nil {
 			return false, fmt.Errorf("failed to delete file: %w", err)
 		}
 		return true, nil
@@ -39,3 +59,43 @@ func (e *Executor) Execute(op core.FileOperation) (bool, error) {
 
 	return false, nil
 }
+
+// place puts op's source at its destination according to the operation
+// type. Only moves take the source away; the other kinds leave it in place.
+func place(op core.FileOperation) error {
+	switch op.OpType {
+	case core.OpCopy:
+		info, err := os.Lstat(op.File.SourcePath)
+		if err != nil {
+			return err
+		}
+		return copyTree(op.File.SourcePath, op.DestPath, info)
+	case core.OpSymlink:
+		target, err := filepath.Abs(op.File.SourcePath)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, op.DestPath)
+	case core.OpHardlink:
+		return os.Link(op.File.SourcePath, op.DestPath)
+	}
+	return moveFile(op.File.SourcePath, op.DestPath)
+}
+
+func verb(t core.OperationType) string {
+	switch t {
+	case core.OpCopy:
+		return "copy"
+	case core.OpSymlink:
+		return "symlink"
+	case core.OpHardlink:
+		return "hardlink"
+	}
+	return "move"
+}
+
+// createsCopy reports whether an operation adds a new path and leaves its
+// source untouched, so undoing it means removing what it created.
+func createsCopy(t core.OperationType) bool {
+	return t == core.OpCopy || t == core.OpSymlink || t == core.OpHardlink
+}
@@ -2,21 +2,35 @@ package ops
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/electr1fy0/sorta/internal/core"
 	"github.com/electr1fy0/sorta/internal/ignore"
+	"github.com/electr1fy0/sorta/internal/trash"
 )
 
 var (
 	DuplNuke         = false
 	RecurseLevel int = 1 << 10
+	// DuplVerify compares every duplicate with its keeper byte for byte
+	// right before removing or relinking it, skipping any that differ.
+	DuplVerify = false
+	// PermanentDelete deletes files, and the duplicates folder with
+	// DuplNuke, for good instead of moving them to the trash. Such
+	// transactions cannot be undone.
+	PermanentDelete = false
+	// KeepEmptyFolders leaves folders that are empty after applying
+	// operations in place, such as ones a user just created in a watched
+	// directory.
+	KeepEmptyFolders = false
 )
 
 func FilterFiles(rootDir string, sorter core.Sorter, executor *Executor, reporter *Reporter) (*core.SortResult, error) {
@@ -48,11 +62,20 @@ func PlanOperationsWithIgnoreCtx(ctx context.Context, rootDir string, sorter cor
 		return nil, walkErr
 	}
 
+	return PlanFilesCtx(ctx, files, sorter)
+}
+
+// PlanFilesCtx plans operations for files that have already been collected,
+// ordered and with destination conflicts resolved.
+func PlanFilesCtx(ctx context.Context, files []core.FileEntry, sorter core.Sorter) ([]core.FileOperation, error) {
 	operations, err := sorter.Decide(ctx, files)
 	if err != nil {
 		return nil, err
 	}
 	sortOperationsDeterministically(operations)
+	if err := resolveConflicts(operations); err != nil {
+		return nil, err
+	}
 	return operations, nil
 }
 
@@ -60,41 +83,81 @@ func ApplyOperations(rootDir string, operations []core.FileOperation, executor *
 	return ApplyOperationsCtx(context.Background(), rootDir, operations, executor, reporter)
 }
 
+// rollbackAction moves From back to To, or, for operations that created a
+// new path, removes Remove. A move never overwrites To unless Replace is
+// set. Restore names a file in the trash to put back at To, Untrash a path
+// to restore from wherever the trash put it, Trash a restored file to send
+// back, and Mkdir a removed folder to recreate.
 type rollbackAction struct {
-	From string
-	To   string
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Replace bool   `json:"replace,omitempty"`
+	Remove  string `json:"remove,omitempty"`
+	Restore string `json:"restore,omitempty"`
+	Untrash string `json:"untrash,omitempty"`
+	Trash   string `json:"trash,omitempty"`
+	Mkdir   string `json:"mkdir,omitempty"`
 }
 
 func ApplyOperationsCtx(ctx context.Context, rootDir string, operations []core.FileOperation, executor *Executor, reporter *Reporter) (*core.SortResult, error) {
+	return applyOperations(ctx, rootDir, operations, executor, reporter, "")
+}
+
+// applyOperations applies operations as one transaction. With reverts set,
+// they redo the operations of that undo: any whose files changed since is
+// reported as a conflict and skipped, and the transaction is logged as a
+// redo.
+func applyOperations(ctx context.Context, rootDir string, operations []core.FileOperation, executor *Executor, reporter *Reporter, reverts string) (*core.SortResult, error) {
 	result := &core.SortResult{}
-	txnDir, err := createTransactionDir(rootDir)
+	tx, err := beginTransaction(rootDir)
 	if err != nil {
 		return result, fmt.Errorf("failed to create transaction dir: %w", err)
 	}
-	rollback := make([]rollbackAction, 0, len(operations)+1)
-	failWithRollback := func(baseErr error, actions []rollbackAction) error {
-		rollbackErr := rollbackAll(actions)
-		if rollbackErr != nil {
-			return fmt.Errorf("%w (rollback failed: %v)", baseErr, rollbackErr)
-		}
-		return baseErr
-	}
 
+	// History records the operations as applied: verification may turn
+	// some into skips, deletions note where the trash put each file, and
+	// files replaced by a conflict policy are recorded as trashed before
+	// the operation that replaced them.
+	applied := make([]core.FileOperation, 0, len(operations))
 	for _, op := range operations {
 		if err := ctx.Err(); err != nil {
-			return result, failWithRollback(fmt.Errorf("operation cancelled: %w", err), rollback)
+			return result, tx.fail(fmt.Errorf("operation cancelled: %w", err))
+		}
+		if reverts != "" && op.OpType != core.OpSkip {
+			if err := checkRedo(op); err != nil {
+				result.Conflicts = append(result.Conflicts, err)
+				op = core.FileOperation{OpType: core.OpSkip, File: op.File}
+			}
+		}
+		// A duplicate folder is moved whole, along with anything the scan
+		// didn't see, so it is always checked against its keeper.
+		if needsVerify(op) && (DuplVerify || isDir(op.File.SourcePath)) {
+			if err := verifyDuplicate(op); err != nil {
+				result.Unverified = append(result.Unverified, err)
+				op = core.FileOperation{OpType: core.OpSkip, File: op.File}
+			}
 		}
 
-		moved, rb, err := applyAtomicOperation(op, executor, txnDir, len(rollback))
+		// A duplicate with other hardlinks keeps its data on disk once it
+		// is relinked, so replacing it frees nothing.
+		if isRelink(op.OpType) && LinkCount(op.File.SourcePath) != 1 {
+			op.Size = 0
+		}
+		moved, trashed, err := applyAtomicOperation(&op, executor, tx)
+		op.Placed = nil
+		if moved && placesFile(op.OpType) {
+			op.Placed = fileID(op.DestPath)
+		}
+		applied = append(applied, trashed...)
+		applied = append(applied, op)
 		if moved || err != nil {
 			reporter.Report(op, err)
 		}
 
 		if err != nil {
 			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", filepath.Base(op.File.SourcePath), err))
-			return result, failWithRollback(fmt.Errorf("failed to apply operations: %w", err), append(rollback, rb...))
+			return result, tx.fail(fmt.Errorf("failed to apply operations: %w", err))
 		}
-		rollback = append(rollback, rb...)
 
 		if moved {
 			switch op.OpType {
@@ -104,6 +167,13 @@ func ApplyOperationsCtx(ctx context.Context, rootDir string, operations []core.F
 				result.Deduped++
 			case core.OpRename:
 				result.Renamed++
+			case core.OpCopy:
+				result.Copied++
+			case core.OpSymlink, core.OpHardlink:
+				result.Linked++
+			case core.OpRelinkHard, core.OpRelinkReflink:
+				result.Deduped++
+				result.Reclaimed += op.Size
 			case core.OpDelete:
 				result.Deleted++
 			}
@@ -113,48 +183,97 @@ func ApplyOperationsCtx(ctx context.Context, rootDir string, operations []core.F
 		}
 	}
 
+	irreversible := PermanentDelete && result.Deleted > 0
 	var nukedCount int
-	if DuplNuke {
-		nc, stagedRollback, err := stageDuplicateNuke(rootDir, txnDir)
-		nukedCount = nc
+	if DuplNuke && reverts == "" {
+		if PermanentDelete {
+			nukedCount, err = stageDuplicateNuke(rootDir, tx)
+			irreversible = true
+		} else {
+			var trashed []core.FileOperation
+			trashed, err = trashDuplicates(rootDir, tx)
+			nukedCount = len(trashed)
+			applied = append(applied, trashed...)
+		}
 		if err != nil {
-			return result, failWithRollback(fmt.Errorf("failed to stage duplicates folder: %w", err), rollback)
+			return result, tx.fail(fmt.Errorf("failed to stage duplicates folder: %w", err))
 		}
-		rollback = append(rollback, stagedRollback...)
 	}
 
-	id := time.Now().UTC().Format(time.RFC3339Nano)
-	transaction := core.Transaction{TType: core.TAction, Operations: operations, ID: id, Irreversible: DuplNuke}
-	if err := LogToHistory(transaction); err != nil {
-		return result, failWithRollback(fmt.Errorf("failed to log history: %w", err), rollback)
+	// Folders left empty are removed as part of the transaction and
+	// recorded, so undo can bring them back.
+	var removedDirs []string
+	if !KeepEmptyFolders {
+		removedDirs, err = cleanEmptyFolders(rootDir, executor.DestRoot, filepath.Join(rootDir, ".sorta"))
+	}
+	if len(removedDirs) > 0 {
+		mkdirs := make([]rollbackAction, len(removedDirs))
+		for i, dir := range removedDirs {
+			mkdirs[i] = rollbackAction{Mkdir: dir}
+		}
+		if recordErr := tx.record(mkdirs); err == nil {
+			err = recordErr
+		}
+	}
+	if err != nil {
+		return result, tx.fail(err)
 	}
 
-	if err := os.RemoveAll(txnDir); err != nil {
-		return result, fmt.Errorf("failed to finalize transaction cleanup: %w", err)
+	ttype := core.TAction
+	if reverts != "" {
+		ttype = core.TRedo
+	}
+	transaction := core.Transaction{
+		TType:        ttype,
+		Operations:   applied,
+		ID:           tx.id,
+		Irreversible: irreversible,
+		Root:         rootDir,
+		DestRoot:     executor.DestRoot,
+		RemovedDirs:  removedDirs,
+		Reverts:      reverts,
+	}
+	if err := LogToHistory(transaction); err != nil {
+		return result, tx.fail(fmt.Errorf("failed to log history: %w", err))
 	}
 
-	if err := cleanEmptyFolders(rootDir); err != nil {
+	if err := tx.commit(); err != nil {
 		return result, err
 	}
 
+	if executor.Cache != nil {
+		if err := executor.Cache.Save(); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to save hash cache: %w", err))
+		}
+	}
+
 	if DuplNuke {
 		result.Deleted += nukedCount
 	}
 	return result, nil
 }
 
-func cleanEmptyFolders(dir string) error {
+// cleanEmptyFolders removes empty folders below dir, leaving the keep paths
+// (such as a sort destination inside dir) and everything under them alone.
+// It returns the folders it removed.
+func cleanEmptyFolders(dir string, keep ...string) ([]string, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
+		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
 
+	var removed []string
 	for _, entry := range entries {
 		path := filepath.Join(dir, entry.Name())
+		if slices.Contains(keep, path) {
+			continue
+		}
 
 		if entry.IsDir() {
-			if err := cleanEmptyFolders(path); err != nil {
-				return err
+			sub, err := cleanEmptyFolders(path, keep...)
+			removed = append(removed, sub...)
+			if err != nil {
+				return removed, err
 			}
 
 			subEntries, err := os.ReadDir(path)
@@ -168,13 +287,29 @@ func cleanEmptyFolders(dir string) error {
 			}
 			if len(subEntries) == 0 || onlyDSStore {
 				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
-					return fmt.Errorf("failed to remove empty dir %q: %w", path, err)
+					return removed, fmt.Errorf("failed to remove empty dir %q: %w", path, err)
 				}
+				removed = append(removed, path)
 			}
 		}
 	}
 
-	return nil
+	return removed, nil
+}
+
+// removeEmptyParents removes dir and then its parents while they are empty,
+// stopping at stop, which is never removed.
+func removeEmptyParents(dir, stop string) {
+	for dir != stop {
+		rel, err := filepath.Rel(stop, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return
+		}
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
 }
 
 func TopLargestFiles(rootDir string, n int) error {
@@ -248,6 +383,10 @@ func WalkFilesWithIgnoreCtx(ctx context.Context, rootDir string, ignoreMatcher *
 		}
 
 		if d.IsDir() {
+			// Views made by "sorta view" are never sorted themselves.
+			if _, err := os.Lstat(filepath.Join(path, viewMarker)); err == nil && path != rootDir {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -256,11 +395,33 @@ func WalkFilesWithIgnoreCtx(ctx context.Context, rootDir string, ignoreMatcher *
 			return err
 		}
 
-		size := stat.Size()
-		return fn(core.FileEntry{RootDir: rootDir, SourcePath: path, Size: size})
+		return fn(newFileEntry(rootDir, path, stat))
 	})
 }
 
+// StatFile builds the FileEntry for a single path below rootDir, as a walk
+// of rootDir would have.
+func StatFile(rootDir, path string) (core.FileEntry, error) {
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return core.FileEntry{}, err
+	}
+	if stat.IsDir() {
+		return core.FileEntry{}, fmt.Errorf("%s is a directory", path)
+	}
+	return newFileEntry(rootDir, path, stat), nil
+}
+
+func newFileEntry(rootDir, path string, stat fs.FileInfo) core.FileEntry {
+	return core.FileEntry{
+		RootDir:    rootDir,
+		SourcePath: path,
+		Size:       stat.Size(),
+		ModTime:    stat.ModTime(),
+		Mode:       stat.Mode(),
+	}
+}
+
 func sortOperationsDeterministically(ops []core.FileOperation) {
 	sort.SliceStable(ops, func(i, j int) bool {
 		a := ops[i]
@@ -286,6 +447,16 @@ func sortOperationsDeterministically(ops []core.FileOperation) {
 	})
 }
 
+// finishTransaction removes txnDir once the transaction is in the history,
+// along with the transactions folder if nothing else is in it.
+func finishTransaction(rootDir, txnDir string) error {
+	if err := os.RemoveAll(txnDir); err != nil {
+		return fmt.Errorf("failed to finalize transaction cleanup: %w", err)
+	}
+	removeEmptyParents(filepath.Dir(txnDir), rootDir)
+	return nil
+}
+
 func createTransactionDir(rootDir string) (string, error) {
 	txnID := time.Now().UTC().Format("20060102T150405.000000000Z")
 	txnDir := filepath.Join(rootDir, ".sorta", "transactions", txnID)
@@ -295,49 +466,98 @@ func createTransactionDir(rootDir string) (string, error) {
 	return txnDir, nil
 }
 
-func stageDuplicateNuke(rootDir, txnDir string) (int, []rollbackAction, error) {
+func stageDuplicateNuke(rootDir string, tx *transaction) (int, error) {
 	duplicatePath := filepath.Join(rootDir, "duplicates")
 	duplicates, _ := os.ReadDir(duplicatePath)
 	nukedCount := len(duplicates)
 
-	var rollback []rollbackAction
 	if _, err := os.Stat(duplicatePath); err == nil {
-		staged := filepath.Join(txnDir, "nuked-duplicates")
-		if err := os.Rename(duplicatePath, staged); err != nil {
-			return 0, nil, fmt.Errorf("failed to rename duplicates to staged: %w", err)
+		staged := tx.stage("nuked", "duplicates")
+		rollback := []rollbackAction{{From: staged, To: duplicatePath}}
+		if err := tx.intend(rollback); err != nil {
+			return 0, err
+		}
+		if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+			tx.done(nil)
+			return 0, err
+		}
+		if err := moveFile(duplicatePath, staged); err != nil {
+			tx.done(nil)
+			return 0, fmt.Errorf("failed to rename duplicates to staged: %w", err)
 		}
-		rollback = append(rollback, rollbackAction{From: staged, To: duplicatePath})
+		tx.done(rollback)
 	}
-	return nukedCount, rollback, nil
+	return nukedCount, nil
 }
 
-func applyAtomicOperation(op core.FileOperation, executor *Executor, txnDir string, idx int) (bool, []rollbackAction, error) {
-	switch op.OpType {
-	case core.OpMove, core.OpDedupe, core.OpRename:
-		moved, err := executor.Execute(op)
-		if err != nil || !moved {
-			return moved, nil, err
+// trashDuplicates moves everything in the duplicates folder to the trash and
+// returns a delete operation for each entry, recording where it went.
+func trashDuplicates(rootDir string, tx *transaction) ([]core.FileOperation, error) {
+	duplicatePath := filepath.Join(rootDir, "duplicates")
+	entries, err := os.ReadDir(duplicatePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
 		}
-		return true, []rollbackAction{{From: op.DestPath, To: op.File.SourcePath}}, nil
-	case core.OpDelete:
-		src := op.File.SourcePath
-		if src == "" {
-			return false, nil, fmt.Errorf("cannot delete: empty source path")
+		return nil, err
+	}
+
+	intended := make([]rollbackAction, len(entries))
+	for i, e := range entries {
+		intended[i] = rollbackAction{Untrash: filepath.Join(duplicatePath, e.Name())}
+	}
+	if err := tx.intend(intended); err != nil {
+		return nil, err
+	}
+
+	var trashed []core.FileOperation
+	var rollback []rollbackAction
+	defer func() { tx.done(rollback) }()
+	for _, e := range entries {
+		path := filepath.Join(duplicatePath, e.Name())
+		file := core.FileEntry{RootDir: rootDir, SourcePath: path}
+		if info, err := e.Info(); err == nil {
+			file.Size, file.ModTime, file.Mode = info.Size(), info.ModTime(), info.Mode()
 		}
-		if _, err := os.Stat(src); err != nil {
-			if os.IsNotExist(err) {
-				return false, nil, nil
-			}
-			return false, nil, err
+		item, err := trash.Put(path)
+		if err != nil {
+			return trashed, err
 		}
-		staged := filepath.Join(txnDir, "deletes", fmt.Sprintf("%06d_%s", idx, filepath.Base(src)))
-		if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
-			return false, nil, err
+		trashed = append(trashed, core.FileOperation{OpType: core.OpDelete, File: file, DestPath: item.Path()})
+		rollback = append(rollback, rollbackAction{Restore: item.Path(), To: path})
+	}
+	if err := os.Remove(duplicatePath); err != nil && !os.IsNotExist(err) {
+		return trashed, err
+	}
+	return trashed, nil
+}
+
+// applyAtomicOperation applies op as steps of tx, logging the intended
+// rollback of each before it is taken. A delete records in op.DestPath
+// where the trash put the file. The file op replaces, if any, goes to the
+// trash and is returned as a delete of its own.
+func applyAtomicOperation(op *core.FileOperation, executor *Executor, tx *transaction) (bool, []core.FileOperation, error) {
+	switch op.OpType {
+	case core.OpMove, core.OpDedupe, core.OpRename, core.OpCopy, core.OpSymlink, core.OpHardlink:
+		if op.DestPath == op.File.SourcePath {
+			return false, nil, nil
 		}
-		if err := os.Rename(src, staged); err != nil {
-			return false, nil, err
+		var trashed []core.FileOperation
+		if op.Resolution == core.ResolveReplaced {
+			replaced, err := trashReplaced(op.File.RootDir, op.DestPath, tx)
+			if err != nil {
+				return false, nil, err
+			}
+			trashed = replaced
 		}
-		return true, []rollbackAction{{From: staged, To: src}}, nil
+		moved, err := applyMove(op, executor, tx)
+		return moved, trashed, err
+	case core.OpRelinkHard, core.OpRelinkReflink:
+		moved, err := applyRelink(*op, tx)
+		return moved, nil, err
+	case core.OpDelete:
+		moved, err := applyDelete(op, tx)
+		return moved, nil, err
 	case core.OpSkip:
 		return false, nil, nil
 	default:
@@ -345,10 +565,152 @@ func applyAtomicOperation(op core.FileOperation, executor *Executor, txnDir stri
 	}
 }
 
+// applyMove moves, copies or links op's source to its destination.
+func applyMove(op *core.FileOperation, executor *Executor, tx *transaction) (bool, error) {
+	// Recovery takes a destination found next to its source for a move
+	// that was cut off, so the destination must be free beforehand.
+	if _, err := os.Lstat(op.DestPath); err == nil {
+		return false, fmt.Errorf("failed to %s file: %s: %w", verb(op.OpType), op.DestPath, os.ErrExist)
+	}
+	rollback := []rollbackAction{{From: op.DestPath, To: op.File.SourcePath}}
+	if createsCopy(op.OpType) {
+		rollback = []rollbackAction{{Remove: op.DestPath}}
+	}
+	if err := tx.intend(rollback); err != nil {
+		return false, err
+	}
+	moved, err := executor.Execute(*op)
+	if err != nil || !moved {
+		tx.done(nil)
+		return moved, err
+	}
+	tx.done(rollback)
+	return true, nil
+}
+
+// applyDelete trashes op's source, or with PermanentDelete stages it for
+// deletion once the transaction is in the history.
+func applyDelete(op *core.FileOperation, tx *transaction) (bool, error) {
+	src := op.File.SourcePath
+	if src == "" {
+		return false, fmt.Errorf("cannot delete: empty source path")
+	}
+	if _, err := os.Stat(src); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !PermanentDelete {
+		if err := tx.intend([]rollbackAction{{Untrash: src}}); err != nil {
+			return false, err
+		}
+		item, err := trash.Put(src)
+		if err != nil {
+			tx.done(nil)
+			return false, err
+		}
+		op.DestPath = item.Path()
+		tx.done([]rollbackAction{{Restore: item.Path(), To: src}})
+		return true, nil
+	}
+	staged := tx.stage("deletes", filepath.Base(src))
+	if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+		return false, err
+	}
+	rollback := []rollbackAction{{From: staged, To: src}}
+	if err := tx.intend(rollback); err != nil {
+		return false, err
+	}
+	if err := moveFile(src, staged); err != nil {
+		tx.done(nil)
+		return false, err
+	}
+	tx.done(rollback)
+	return true, nil
+}
+
+// trashReplaced moves the file an operation replaces to the trash and
+// returns a delete recording where it went, so undo can restore it.
+func trashReplaced(rootDir, path string, tx *transaction) ([]core.FileOperation, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.intend([]rollbackAction{{Untrash: path}}); err != nil {
+		return nil, err
+	}
+	item, err := trash.Put(path)
+	if err != nil {
+		tx.done(nil)
+		return nil, fmt.Errorf("failed to trash replaced file: %w", err)
+	}
+	tx.done([]rollbackAction{{Restore: item.Path(), To: path}})
+	file := core.FileEntry{RootDir: rootDir, SourcePath: path, Size: info.Size(), ModTime: info.ModTime(), Mode: info.Mode()}
+	return []core.FileOperation{{OpType: core.OpDelete, File: file, DestPath: item.Path()}}, nil
+}
+
 func rollbackAll(actions []rollbackAction) error {
 	var rollbackErrors []error
+	var trashed map[string]trash.Item
 	for i := len(actions) - 1; i >= 0; i-- {
 		a := actions[i]
+		if a.Restore != "" {
+			item, err := trash.Lookup(a.Restore)
+			if err == nil {
+				err = trash.Restore(item, a.To)
+			}
+			if err != nil {
+				rollbackErrors = append(rollbackErrors, err)
+			}
+			continue
+		}
+		if a.Untrash != "" {
+			if _, err := os.Lstat(a.Untrash); err == nil {
+				continue
+			}
+			if trashed == nil {
+				items, err := trash.List()
+				if err != nil {
+					rollbackErrors = append(rollbackErrors, err)
+					continue
+				}
+				// items is oldest first, so the newest item from a path wins.
+				trashed = make(map[string]trash.Item, len(items))
+				for _, item := range items {
+					trashed[item.OriginalPath] = item
+				}
+			}
+			item, ok := trashed[a.Untrash]
+			if !ok {
+				continue
+			}
+			if err := trash.Restore(item, a.Untrash); err != nil && !errors.Is(err, trash.ErrNotTrashed) {
+				rollbackErrors = append(rollbackErrors, err)
+			}
+			continue
+		}
+		if a.Trash != "" {
+			if _, err := trash.Put(a.Trash); err != nil && !os.IsNotExist(err) {
+				rollbackErrors = append(rollbackErrors, err)
+			}
+			continue
+		}
+		if a.Mkdir != "" {
+			if err := os.MkdirAll(a.Mkdir, 0755); err != nil {
+				rollbackErrors = append(rollbackErrors, err)
+			}
+			continue
+		}
+		if a.Remove != "" {
+			if err := os.RemoveAll(a.Remove); err != nil {
+				rollbackErrors = append(rollbackErrors, err)
+			}
+			continue
+		}
 		if a.From == "" || a.To == "" {
 			continue
 		}
@@ -359,11 +721,21 @@ func rollbackAll(actions []rollbackAction) error {
 			rollbackErrors = append(rollbackErrors, err)
 			continue
 		}
+		if _, err := os.Lstat(a.To); err == nil {
+			if !a.Replace {
+				rollbackErrors = append(rollbackErrors, fmt.Errorf("cannot move %s back: %s: %w", a.From, a.To, os.ErrExist))
+				continue
+			}
+			if err := os.RemoveAll(a.To); err != nil {
+				rollbackErrors = append(rollbackErrors, err)
+				continue
+			}
+		}
 		if err := os.MkdirAll(filepath.Dir(a.To), 0755); err != nil {
 			rollbackErrors = append(rollbackErrors, err)
 			continue
 		}
-		if err := os.Rename(a.From, a.To); err != nil {
+		if err := moveFile(a.From, a.To); err != nil {
 			rollbackErrors = append(rollbackErrors, err)
 		}
 	}
@@ -1,11 +1,9 @@
 package ops
 
 import (
-	"encoding/json"
 	"errors"
-	"fmt"
-	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/electr1fy0/sorta/internal/core"
@@ -14,119 +12,232 @@ import (
 var (
 	ErrAlreadyUndone = errors.New("last operation already undone")
 	ErrNoHistory     = errors.New("no recorded operation found for this directory")
+	ErrNothingToRedo = errors.New("nothing to redo")
+	// ErrTouchedLater is returned when undoing a transaction whose files
+	// a later transaction, still in effect, has touched too.
+	ErrTouchedLater = errors.New("later operations touched the same files")
 )
 
-func LogToHistory(transaction core.Transaction) error {
-	sortaDir, err := core.GetSortaDir()
+// TrashedPaths returns where in the trash each file the history records
+// sorta trashing was put, so the trash can be told apart from what other
+// programs put there.
+func TrashedPaths() (map[string]bool, error) {
+	txns, err := GetHistory()
 	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(sortaDir, 0755); err != nil {
-		return err
+		return nil, err
 	}
-	historyPath := filepath.Join(sortaDir, "history")
-	data, err := json.Marshal(transaction)
-	if err != nil {
-		return err
+	paths := make(map[string]bool)
+	for _, t := range txns {
+		for _, op := range t.Operations {
+			if op.OpType == core.OpDelete && op.DestPath != "" {
+				paths[op.DestPath] = true
+			}
+		}
 	}
-	return core.AppendLineAtomic(historyPath, string(data), 0644)
+	return paths, nil
 }
 
-func Undo(path string) error {
-	if !filepath.IsAbs(path) {
-		var err error
-		path, err = filepath.Abs(path)
-		if err != nil {
-			return err
-		}
-	}
-	t, err := readLastTransaction(path)
+// timeline is the recorded history with every undo and redo resolved to the
+// transaction it reverts.
+type timeline struct {
+	txns []core.Transaction
+	// revertedBy maps a transaction's ID to the undo or redo reverting it.
+	// An undo that left some operations alone only counts once later undos
+	// have reverted the rest.
+	revertedBy map[string]string
+	// undoneOps holds the operations of each transaction undos reverted,
+	// while some are still in effect.
+	undoneOps map[string]map[opKey]bool
+}
 
+// loadTimeline loads the transactions recorded for root. Transactions on
+// other directories are left out, even when they touched files below root.
+func loadTimeline(root string) (*timeline, error) {
+	txns, err := historyForRoot(root)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	if t.Irreversible {
-		return fmt.Errorf("cannot undo irreversible operation (e.g. used --nuke)")
+	tl := &timeline{
+		revertedBy: make(map[string]string),
+		undoneOps:  make(map[string]map[opKey]bool),
+	}
+	for _, t := range txns {
+		if len(t.Operations) == 0 {
+			continue
+		}
+		// Undo entries from older versions don't say what they revert:
+		// it was always the latest operation still in effect on the root.
+		if t.TType == core.TUndo && t.Reverts == "" {
+			if target, ok := tl.latest(t.RootDir(), 1); ok {
+				t.Reverts = target[0].ID
+			}
+		}
+		if t.TType == core.TUndo && t.Reverts != "" {
+			tl.undid(t)
+		} else if t.Reverts != "" {
+			tl.revertedBy[t.Reverts] = t.ID
+		}
+		tl.txns = append(tl.txns, t)
 	}
+	return tl, nil
+}
 
-	t.TType = core.TUndo
-	if err := LogToHistory(t); err != nil {
-		return err
+// undid records the operations undo u reverted. Their transaction is
+// reverted once none of its operations are left in effect.
+func (tl *timeline) undid(u core.Transaction) {
+	target, ok := tl.find(u.Reverts)
+	if !ok {
+		tl.revertedBy[u.Reverts] = u.ID
+		return
+	}
+	undone := tl.undoneOps[target.ID]
+	if undone == nil {
+		undone = make(map[opKey]bool)
+		tl.undoneOps[target.ID] = undone
+	}
+	for _, op := range u.Operations {
+		undone[keyOf(op)] = true
+	}
+	if len(tl.remaining(target).Operations) == 0 {
+		tl.revertedBy[target.ID] = u.ID
+		delete(tl.undoneOps, target.ID)
 	}
+}
 
-	var executor Executor
+// remaining returns t without the operations undos have already reverted.
+func (tl *timeline) remaining(t core.Transaction) core.Transaction {
+	undone := tl.undoneOps[t.ID]
+	if undone == nil {
+		return t
+	}
+	var ops []core.FileOperation
 	for _, op := range t.Operations {
-		op.File.SourcePath, op.DestPath = op.DestPath, op.File.SourcePath
-		executor.Execute(op)
+		if op.OpType != core.OpSkip && !undone[keyOf(op)] {
+			ops = append(ops, op)
+		}
 	}
-	return nil
+	t.Operations = ops
+	return t
 }
 
-func readLastTransaction(root string) (core.Transaction, error) {
-	sortaDir, err := core.GetSortaDir()
-	if err != nil {
-		return core.Transaction{}, err
+// opKey identifies an operation within its transaction.
+type opKey struct {
+	opType    core.OperationType
+	src, dest string
+}
+
+func keyOf(op core.FileOperation) opKey {
+	return opKey{op.OpType, op.File.SourcePath, op.DestPath}
+}
+
+// inEffect reports whether t has changed files and not been reverted.
+func (tl *timeline) inEffect(t core.Transaction) bool {
+	return t.TType != core.TUndo && tl.revertedBy[t.ID] == ""
+}
+
+func onRoot(t core.Transaction, root string) bool {
+	return t.RootDir() == root || t.DestRoot == root
+}
+
+// latest returns up to n transactions on root still in effect, newest first.
+func (tl *timeline) latest(root string, n int) ([]core.Transaction, bool) {
+	var found []core.Transaction
+	for _, t := range slices.Backward(tl.txns) {
+		if len(found) == n {
+			break
+		}
+		if onRoot(t, root) && tl.inEffect(t) {
+			found = append(found, tl.remaining(t))
+		}
 	}
-	historyPath := filepath.Join(sortaDir, "history")
+	return found, len(found) > 0
+}
 
-	data, err := os.ReadFile(historyPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return core.Transaction{}, fmt.Errorf("%w: %s", ErrNoHistory, root)
+// find returns the transaction with the given ID.
+func (tl *timeline) find(id string) (core.Transaction, bool) {
+	for _, t := range tl.txns {
+		if t.ID == id {
+			return t, true
 		}
-		return core.Transaction{}, err
 	}
-	lines := strings.Split(string(data), "\n")
+	return core.Transaction{}, false
+}
 
-	var transaction core.Transaction
-	for i := len(lines) - 1; i >= 0; i-- {
-		line := lines[i]
-		if strings.TrimSpace(line) == "" {
+// redoable returns the undo on root that redo would revert: the latest one
+// not yet redone, as long as no new operation has been run since.
+func (tl *timeline) redoable(root string) (core.Transaction, bool) {
+	for _, t := range slices.Backward(tl.txns) {
+		if !onRoot(t, root) {
 			continue
 		}
-		if err := json.Unmarshal([]byte(line), &transaction); err != nil {
-			return core.Transaction{}, err
+		switch {
+		case t.TType == core.TAction:
+			return core.Transaction{}, false
+		case t.TType == core.TUndo && tl.revertedBy[t.ID] == "":
+			return t, true
 		}
+	}
+	return core.Transaction{}, false
+}
 
-		if len(transaction.Operations) == 0 || transaction.Operations[0].File.RootDir != root {
+// touchedLater returns a transaction after t, still in effect, that touched
+// any of the files t did.
+func (tl *timeline) touchedLater(t core.Transaction) (core.Transaction, bool) {
+	paths := touchedPaths(tl.remaining(t))
+	after := false
+	for _, later := range tl.txns {
+		if later.ID == t.ID {
+			after = true
 			continue
 		}
-		if transaction.TType == core.TUndo {
-			return core.Transaction{}, fmt.Errorf("last operation in %s was already undone: %w", root, ErrAlreadyUndone)
+		if !after || !tl.inEffect(later) {
+			continue
+		}
+		for p := range touchedPaths(tl.remaining(later)) {
+			if underAny(p, paths) || containsAny(p, paths) {
+				return later, true
+			}
 		}
-		return transaction, nil
 	}
-	return core.Transaction{}, fmt.Errorf("%w: %s", ErrNoHistory, root)
+	return core.Transaction{}, false
 }
 
-func GetHistory() ([]core.Transaction, error) {
-	sortaDir, err := core.GetSortaDir()
-	if err != nil {
-		return nil, err
-	}
-	historyPath := filepath.Join(sortaDir, "history")
-
-	data, err := os.ReadFile(historyPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
+// touchedPaths lists the paths t's operations changed. Keepers and trash
+// locations aren't among them.
+func touchedPaths(t core.Transaction) map[string]bool {
+	paths := make(map[string]bool)
+	for _, op := range t.Operations {
+		if op.OpType == core.OpSkip {
+			continue
+		}
+		paths[op.File.SourcePath] = true
+		if op.DestPath != "" && op.OpType != core.OpDelete && !isRelink(op.OpType) {
+			paths[op.DestPath] = true
 		}
-		return nil, err
 	}
+	return paths
+}
 
-	var transactions []core.Transaction
-
-	for line := range strings.Lines(string(data)) {
-		if strings.TrimSpace(line) == "" {
-			continue
+// underAny reports whether path or one of its ancestors is in set.
+func underAny(path string, set map[string]bool) bool {
+	for p := path; ; {
+		if set[p] {
+			return true
 		}
-		var t core.Transaction
-		if err := json.Unmarshal([]byte(line), &t); err != nil {
-			return nil, err
+		parent := filepath.Dir(p)
+		if parent == p {
+			return false
 		}
-		transactions = append(transactions, t)
+		p = parent
 	}
+}
 
-	return transactions, nil
+// containsAny reports whether a path in set lies below dir.
+func containsAny(dir string, set map[string]bool) bool {
+	for p := range set {
+		if rel, err := filepath.Rel(dir, p); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,411 @@
+package ops
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/journal"
+)
+
+const (
+	historyName      = "history"
+	historyIndexName = "history.index"
+	historyLockName  = "history.lock"
+	// The history is rotated once it reaches historySegmentSize, keeping
+	// the historySegments most recent rotated segments besides the current
+	// one.
+	historySegmentSize = 8 << 20
+	historySegments    = 16
+)
+
+// historyIndexEntry locates one history record and the directories its
+// transaction ran on, so the history of a directory can be read without
+// parsing every transaction. Damaged records get an entry without an ID.
+type historyIndexEntry struct {
+	ID      string   `json:"id,omitempty"`
+	Segment string   `json:"segment"`
+	Offset  int64    `json:"offset"`
+	End     int64    `json:"end"`
+	Roots   []string `json:"roots,omitempty"`
+}
+
+// LogToHistory appends transaction to the history journal and flushes it
+// to disk.
+func LogToHistory(transaction core.Transaction) error {
+	dir, err := historyDir()
+	if err != nil {
+		return err
+	}
+	// Rotating renames segments, so two processes doing it at once could
+	// lose one. A failed rotation only leaves the current segment to grow,
+	// which is no reason to fail the transaction being logged.
+	unlock, err := lockHistory(dir)
+	if err != nil {
+		historyWarning(fmt.Errorf("not rotating history: %w", err))
+	} else {
+		defer unlock()
+		if err := rotateHistory(dir); err != nil {
+			historyWarning(fmt.Errorf("failed to rotate history: %w", err))
+		}
+	}
+
+	w, err := journal.OpenWriter(filepath.Join(dir, historyName))
+	if err != nil {
+		return err
+	}
+	offset, end, err := w.AppendAt(transaction)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	// The index is rebuilt from the history whenever it falls behind, so
+	// failing to update it only costs a rescan later.
+	if iw, err := journal.OpenWriter(filepath.Join(dir, historyIndexName)); err == nil {
+		_ = iw.Append(newIndexEntry(transaction, historyName, offset, end))
+		_ = iw.Close()
+	}
+	return nil
+}
+
+// GetHistory returns every recorded transaction, oldest first. Damaged
+// records are skipped with a warning.
+func GetHistory() ([]core.Transaction, error) {
+	dir, err := historyDir()
+	if err != nil {
+		return nil, err
+	}
+	segments, err := historySegmentNames(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []core.Transaction
+	for _, seg := range segments {
+		path := filepath.Join(dir, seg)
+		err := journal.Read(path, func(payload []byte) error {
+			var t core.Transaction
+			if err := json.Unmarshal(payload, &t); err != nil {
+				historyWarning(fmt.Errorf("%s: skipping unreadable transaction: %w", path, err))
+				return nil
+			}
+			transactions = append(transactions, t)
+			return nil
+		})
+		if errors.Is(err, journal.ErrCorrupt) {
+			historyWarning(err)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return transactions, nil
+}
+
+// historyForRoot returns the transactions run on root, oldest first, reading
+// only their records.
+func historyForRoot(root string) ([]core.Transaction, error) {
+	dir, err := historyDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := loadHistoryIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []core.Transaction
+	for _, e := range entries {
+		if e.ID == "" || !slices.Contains(e.Roots, root) {
+			continue
+		}
+		path := filepath.Join(dir, e.Segment)
+		payload, err := journal.ReadRecord(path, e.Offset, e.End)
+		if err != nil {
+			historyWarning(err)
+			continue
+		}
+		var t core.Transaction
+		if err := json.Unmarshal(payload, &t); err != nil {
+			historyWarning(fmt.Errorf("%s: skipping unreadable transaction %s: %w", path, e.ID, err))
+			continue
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, nil
+}
+
+func historyWarning(err error) {
+	fmt.Fprintf(os.Stderr, "history warning: %v\n", err)
+}
+
+// historyDir returns the directory holding the history, converting a
+// history from older versions first.
+func historyDir() (string, error) {
+	dir, err := core.GetSortaDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if err := migrateHistory(dir); err != nil {
+		return "", fmt.Errorf("failed to convert history: %w", err)
+	}
+	return dir, nil
+}
+
+// migrateHistory turns a history written by older versions, one bare JSON
+// transaction per line, into journal records.
+func migrateHistory(dir string) error {
+	path := filepath.Join(dir, historyName)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	// Only the first byte tells the formats apart, so the whole file is
+	// read just once, when it needs converting.
+	first := make([]byte, 1)
+	_, err = io.ReadFull(f, first)
+	f.Close()
+	if err == io.EOF || (err == nil && first[0] != '{') {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var records []any
+	dropped := 0
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !json.Valid([]byte(line)) {
+			dropped++
+			continue
+		}
+		records = append(records, json.RawMessage(line))
+	}
+	if err := journal.Rewrite(path, func(w *journal.Writer) error {
+		return w.Append(records...)
+	}); err != nil {
+		return err
+	}
+	if dropped > 0 {
+		historyWarning(fmt.Errorf("%s: dropped %d unreadable lines while converting", path, dropped))
+	}
+	if err := os.Remove(filepath.Join(dir, historyIndexName)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// historySegmentNames lists the rotated segments, oldest first, followed by
+// the current one.
+func historySegmentNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if _, ok := segmentNumber(e.Name()); ok {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, _ := segmentNumber(names[i])
+		b, _ := segmentNumber(names[j])
+		return a < b
+	})
+	return append(names, historyName), nil
+}
+
+// segmentNumber parses the number of a rotated segment, history.<n>.
+func segmentNumber(name string) (int, bool) {
+	suffix, ok := strings.CutPrefix(name, historyName+".")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(suffix)
+	return n, err == nil
+}
+
+// rotateHistory moves the current history aside once it has grown past
+// historySegmentSize, dropping the oldest segments beyond historySegments.
+func rotateHistory(dir string) error {
+	current := filepath.Join(dir, historyName)
+	info, err := os.Stat(current)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() < historySegmentSize {
+		return nil
+	}
+
+	segments, err := historySegmentNames(dir)
+	if err != nil {
+		return err
+	}
+	archived := segments[:len(segments)-1]
+	next := 1
+	if len(archived) > 0 {
+		last, _ := segmentNumber(archived[len(archived)-1])
+		next = last + 1
+	}
+	name := fmt.Sprintf("%s.%06d", historyName, next)
+	if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+		return fmt.Errorf("%s: %w", name, os.ErrExist)
+	}
+	if err := os.Rename(current, filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	archived = append(archived, name)
+	for len(archived) > historySegments {
+		if err := os.Remove(filepath.Join(dir, archived[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		archived = archived[1:]
+	}
+
+	// Point the index at the renamed segment. If this fails, the next
+	// read finds the index out of step and rebuilds it.
+	entries, _ := readHistoryIndex(dir)
+	var kept []historyIndexEntry
+	for _, e := range entries {
+		if e.Segment == historyName {
+			e.Segment = name
+		}
+		if slices.Contains(archived, e.Segment) {
+			kept = append(kept, e)
+		}
+	}
+	_ = writeHistoryIndex(dir, kept)
+	return nil
+}
+
+func readHistoryIndex(dir string) ([]historyIndexEntry, error) {
+	var entries []historyIndexEntry
+	err := journal.Read(filepath.Join(dir, historyIndexName), func(payload []byte) error {
+		var e historyIndexEntry
+		if json.Unmarshal(payload, &e) == nil {
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func writeHistoryIndex(dir string, entries []historyIndexEntry) error {
+	return journal.Rewrite(filepath.Join(dir, historyIndexName), func(w *journal.Writer) error {
+		records := make([]any, len(entries))
+		for i, e := range entries {
+			records[i] = e
+		}
+		return w.Append(records...)
+	})
+}
+
+// loadHistoryIndex returns the index of every segment, oldest first. The
+// entries of a segment must cover it end to end; a segment they don't
+// cover, after a crash or a damaged index, is scanned again and the index
+// rewritten.
+func loadHistoryIndex(dir string) ([]historyIndexEntry, error) {
+	entries, err := readHistoryIndex(dir)
+	dirty := err != nil
+	if err != nil && !errors.Is(err, journal.ErrCorrupt) {
+		return nil, err
+	}
+	segments, err := historySegmentNames(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	bySegment := make(map[string][]historyIndexEntry)
+	for _, e := range entries {
+		bySegment[e.Segment] = append(bySegment[e.Segment], e)
+	}
+	var index []historyIndexEntry
+	for _, seg := range segments {
+		path := filepath.Join(dir, seg)
+		var size int64
+		if info, err := os.Stat(path); err == nil {
+			size = info.Size()
+		}
+
+		segEntries := bySegment[seg]
+		sort.Slice(segEntries, func(i, j int) bool { return segEntries[i].Offset < segEntries[j].Offset })
+		if !coversSegment(segEntries, size) {
+			dirty = true
+			segEntries, err = scanHistorySegment(dir, seg)
+			if err != nil {
+				return nil, err
+			}
+		}
+		index = append(index, segEntries...)
+	}
+
+	if dirty || len(index) != len(entries) {
+		if err := writeHistoryIndex(dir, index); err != nil {
+			historyWarning(fmt.Errorf("failed to save history index: %w", err))
+		}
+	}
+	return index, nil
+}
+
+// coversSegment reports whether entries, in order, account for every byte
+// of a segment of the given size.
+func coversSegment(entries []historyIndexEntry, size int64) bool {
+	var pos int64
+	for _, e := range entries {
+		if e.Offset != pos {
+			return false
+		}
+		pos = e.End
+	}
+	return pos == size
+}
+
+func scanHistorySegment(dir, seg string) ([]historyIndexEntry, error) {
+	var entries []historyIndexEntry
+	err := journal.Scan(filepath.Join(dir, seg), func(r journal.Record) error {
+		var t core.Transaction
+		if !r.OK || json.Unmarshal(r.Payload, &t) != nil {
+			entries = append(entries, historyIndexEntry{Segment: seg, Offset: r.Offset, End: r.End})
+			return nil
+		}
+		entries = append(entries, newIndexEntry(t, seg, r.Offset, r.End))
+		return nil
+	})
+	return entries, err
+}
+
+func newIndexEntry(t core.Transaction, seg string, offset, end int64) historyIndexEntry {
+	roots := []string{t.RootDir()}
+	if t.DestRoot != "" && t.DestRoot != roots[0] {
+		roots = append(roots, t.DestRoot)
+	}
+	return historyIndexEntry{ID: t.ID, Segment: seg, Offset: offset, End: end, Roots: roots}
+}
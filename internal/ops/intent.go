@@ -0,0 +1,387 @@
+package ops
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/journal"
+)
+
+const (
+	intentLogName = "intent.log"
+	lockName      = "lock"
+	pendingDir    = "pending"
+)
+
+// intentRecord is one entry of a transaction's intent log. Before each step
+// the actions that would roll it back are logged and synced ("intent"), and
+// once the step is taken the actions it actually needs ("done"). "commit"
+// follows once the transaction is in the history.
+type intentRecord struct {
+	Kind    string           `json:"kind"`
+	Step    int              `json:"step,omitempty"`
+	Actions []rollbackAction `json:"actions,omitempty"`
+	ID      string           `json:"id,omitempty"`
+	Root    string           `json:"root,omitempty"`
+	PID     int              `json:"pid,omitempty"`
+}
+
+// transaction is a transaction dir being applied, with its write-ahead
+// intent log, so the steps taken so far can be rolled back even after a
+// crash, and the rollback needed if it fails now.
+type transaction struct {
+	id       string
+	rootDir  string
+	dir      string
+	log      *journal.Writer
+	lock     *os.File
+	marker   string
+	step     int
+	pending  bool
+	staged   int
+	rollback []rollbackAction
+}
+
+// beginTransaction creates a transaction dir below rootDir and starts its
+// intent log. A marker in the global sorta dir lets any command notice the
+// transaction if it is never finished.
+func beginTransaction(rootDir string) (*transaction, error) {
+	dir, err := createTransactionDir(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := lockTransaction(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to lock transaction: %w", err)
+	}
+	log, err := journal.OpenWriter(filepath.Join(dir, intentLogName))
+	if err != nil {
+		os.RemoveAll(dir)
+		lock.Close()
+		return nil, err
+	}
+	tx := &transaction{
+		id:      time.Now().UTC().Format(time.RFC3339Nano),
+		rootDir: rootDir,
+		dir:     dir,
+		log:     log,
+		lock:    lock,
+	}
+	if err := tx.write(intentRecord{Kind: "begin", ID: tx.id, Root: rootDir, PID: os.Getpid()}, true); err != nil {
+		tx.log.Close()
+		os.RemoveAll(dir)
+		tx.unlock()
+		return nil, err
+	}
+	if sortaDir, err := core.GetSortaDir(); err == nil {
+		marker := filepath.Join(sortaDir, pendingDir, fmt.Sprintf("%s-%d", filepath.Base(dir), os.Getpid()))
+		if os.MkdirAll(filepath.Dir(marker), 0755) == nil && os.WriteFile(marker, []byte(dir+"\n"), 0644) == nil {
+			tx.marker = marker
+		}
+	}
+	return tx, nil
+}
+
+func (tx *transaction) write(rec intentRecord, sync bool) error {
+	if err := tx.log.Append(rec); err != nil {
+		return fmt.Errorf("failed to write intent log: %w", err)
+	}
+	if sync {
+		if err := tx.log.Sync(); err != nil {
+			return fmt.Errorf("failed to write intent log: %w", err)
+		}
+	}
+	return nil
+}
+
+// stage returns a fresh path in the transaction dir for a file set aside
+// under kind.
+func (tx *transaction) stage(kind, name string) string {
+	tx.staged++
+	return filepath.Join(tx.dir, kind, fmt.Sprintf("%06d_%s", tx.staged, name))
+}
+
+// intend logs the actions that undo the next step, whether it completes or
+// not, and syncs the log before the step is taken.
+func (tx *transaction) intend(actions []rollbackAction) error {
+	tx.step++
+	tx.pending = true
+	return tx.write(intentRecord{Kind: "intent", Step: tx.step, Actions: actions}, true)
+}
+
+// done records the rollback a step actually needs. The record isn't
+// synced: if it is lost, recovery falls back on the step's intent.
+func (tx *transaction) done(actions []rollbackAction) {
+	tx.rollback = append(tx.rollback, actions...)
+	if tx.pending {
+		tx.pending = false
+		_ = tx.write(intentRecord{Kind: "done", Step: tx.step, Actions: actions}, false)
+	}
+}
+
+// record logs a step that has already been taken.
+func (tx *transaction) record(actions []rollbackAction) error {
+	if err := tx.intend(actions); err != nil {
+		return err
+	}
+	tx.done(actions)
+	return nil
+}
+
+// fail rolls back every step taken and returns baseErr. If the rollback
+// goes wrong, the transaction dir and its intent log stay behind for
+// 'sorta recover'.
+func (tx *transaction) fail(baseErr error) error {
+	// The dir goes before the lock is released, so a recover starting in
+	// between can't find it unlocked and roll it back a second time.
+	defer tx.unlock()
+	err := rollbackAll(tx.rollback)
+	tx.log.Close()
+	if err != nil {
+		return fmt.Errorf("%w (rollback failed: %v; run 'sorta recover %s')", baseErr, err, tx.rootDir)
+	}
+	_ = finishTransaction(tx.rootDir, tx.dir)
+	tx.removeMarker()
+	return baseErr
+}
+
+// commit marks the transaction as recorded in the history and removes its
+// dir, discarding whatever it staged.
+func (tx *transaction) commit() error {
+	defer tx.unlock()
+	_ = tx.write(intentRecord{Kind: "commit"}, true)
+	tx.log.Close()
+	if err := finishTransaction(tx.rootDir, tx.dir); err != nil {
+		return err
+	}
+	tx.removeMarker()
+	return nil
+}
+
+func (tx *transaction) unlock() {
+	if tx.lock != nil {
+		tx.lock.Close()
+	}
+}
+
+func (tx *transaction) removeMarker() {
+	if tx.marker != "" {
+		_ = os.Remove(tx.marker)
+	}
+}
+
+// Recovery describes what Recover did with one leftover transaction.
+type Recovery struct {
+	Dir string
+	ID  string
+	// Finished is set for a transaction that was already in the history,
+	// which only needed its dir cleaned up. Otherwise RolledBack steps
+	// were undone.
+	Finished   bool
+	RolledBack int
+	Err        error
+}
+
+// LeftoverTransactions returns the transaction dirs below rootDir that no
+// running sorta process is working on.
+func LeftoverTransactions(rootDir string) []string {
+	base := filepath.Join(rootDir, ".sorta", "transactions")
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(base, e.Name())
+		if begin, _ := readBegin(dir); transactionBusy(dir, begin.PID) {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// PendingRoots returns the directories with a transaction that was started
+// and never finished by a process that is no longer running.
+func PendingRoots() []string {
+	sortaDir, err := core.GetSortaDir()
+	if err != nil {
+		return nil
+	}
+	markers, err := os.ReadDir(filepath.Join(sortaDir, pendingDir))
+	if err != nil {
+		return nil
+	}
+	var roots []string
+	for _, m := range markers {
+		path := filepath.Join(sortaDir, pendingDir, m.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		dir := strings.TrimSpace(string(data))
+		if _, err := os.Stat(dir); err != nil {
+			_ = os.Remove(path)
+			continue
+		}
+		if begin, _ := readBegin(dir); transactionBusy(dir, begin.PID) {
+			continue
+		}
+		// <root>/.sorta/transactions/<id>
+		roots = append(roots, filepath.Dir(filepath.Dir(filepath.Dir(dir))))
+	}
+	return roots
+}
+
+// Recover finishes or rolls back every leftover transaction below rootDir.
+// A transaction that made it into the history is finished; any other is
+// rolled back step by step from its intent log.
+func Recover(rootDir string) []Recovery {
+	var recoveries []Recovery
+	for _, dir := range LeftoverTransactions(rootDir) {
+		// The lock is held until the transaction is done with, so a
+		// second recover running at the same time leaves it alone.
+		lock, ok := lockLeftover(dir)
+		if !ok {
+			continue
+		}
+		recoveries = append(recoveries, recoverTransaction(rootDir, dir))
+		if lock != nil {
+			lock.Close()
+		}
+	}
+	return recoveries
+}
+
+func readIntentLog(dir string) ([]intentRecord, error) {
+	var records []intentRecord
+	err := journal.Read(filepath.Join(dir, intentLogName), func(payload []byte) error {
+		var rec intentRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return err
+		}
+		records = append(records, rec)
+		return nil
+	})
+	return records, err
+}
+
+func readBegin(dir string) (intentRecord, bool) {
+	records, _ := readIntentLog(dir)
+	if len(records) == 0 || records[0].Kind != "begin" {
+		return intentRecord{}, false
+	}
+	return records[0], true
+}
+
+func recoverTransaction(rootDir, dir string) Recovery {
+	rec := Recovery{Dir: dir}
+	records, err := readIntentLog(dir)
+	if err != nil && !errors.Is(err, journal.ErrCorrupt) {
+		rec.Err = err
+		return rec
+	}
+	if len(records) == 0 || records[0].Kind != "begin" {
+		rec.Err = fmt.Errorf("no intent log, so it was left alone; check its staged files by hand")
+		return rec
+	}
+	rec.ID = records[0].ID
+	if err != nil {
+		historyWarning(err)
+	}
+
+	committed := false
+	intents := make(map[int][]rollbackAction)
+	done := make(map[int][]rollbackAction)
+	var steps []int
+	for _, r := range records[1:] {
+		switch r.Kind {
+		case "intent":
+			intents[r.Step] = r.Actions
+			steps = append(steps, r.Step)
+		case "done":
+			done[r.Step] = r.Actions
+		case "commit":
+			committed = true
+		}
+	}
+	if !committed {
+		committed = inHistory(rootDir, rec.ID)
+	}
+
+	if committed {
+		rec.Finished = true
+	} else {
+		var actions []rollbackAction
+		for _, step := range steps {
+			if a, ok := done[step]; ok {
+				actions = append(actions, a...)
+				continue
+			}
+			actions = append(actions, unfinishedStep(intents[step])...)
+		}
+		if err := rollbackAll(actions); err != nil {
+			rec.Err = fmt.Errorf("rollback failed: %w; the transaction dir was kept", err)
+			return rec
+		}
+		rec.RolledBack = len(steps)
+		// Folders the transaction created for files it moved go again.
+		for _, a := range actions {
+			if a.From != "" {
+				removeEmptyParents(filepath.Dir(a.From), rootDir)
+			}
+		}
+	}
+
+	if err := finishTransaction(rootDir, dir); err != nil {
+		rec.Err = err
+		return rec
+	}
+	if sortaDir, err := core.GetSortaDir(); err == nil && records[0].PID != 0 {
+		_ = os.Remove(filepath.Join(sortaDir, pendingDir, fmt.Sprintf("%s-%d", filepath.Base(dir), records[0].PID)))
+	}
+	return rec
+}
+
+// unfinishedStep adjusts the intended rollback of a step that was cut off.
+// moveFile only puts a copy in place once it is complete, so where both
+// ends of a move exist the copy finished and removing the original was cut
+// short. The copy is moved back over what is left of the original.
+func unfinishedStep(actions []rollbackAction) []rollbackAction {
+	adjusted := make([]rollbackAction, 0, len(actions))
+	for _, a := range actions {
+		if a.From != "" && a.To != "" && !a.Replace {
+			_, fromErr := os.Lstat(a.From)
+			_, toErr := os.Lstat(a.To)
+			if fromErr == nil && toErr == nil {
+				a.Replace = true
+			}
+		}
+		adjusted = append(adjusted, a)
+	}
+	return adjusted
+}
+
+// inHistory reports whether the transaction with the given ID was logged.
+func inHistory(rootDir, id string) bool {
+	txns, err := historyForRoot(rootDir)
+	if err != nil {
+		return false
+	}
+	for _, t := range txns {
+		if t.ID == id {
+			return true
+		}
+	}
+	return false
+}
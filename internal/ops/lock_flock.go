@@ -0,0 +1,83 @@
+//go:build unix && !aix && !solaris
+
+package ops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockTransaction takes an exclusive lock in the transaction dir, held until
+// the returned file is closed or the process exits.
+func lockTransaction(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// lockHistory takes an exclusive lock on the history in dir, waiting for
+// any other sorta process that holds it. Call the returned func to release
+// it.
+func lockHistory(dir string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, historyLockName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() { f.Close() }, nil
+}
+
+// lockLeftover takes the lock of a leftover transaction for recovery, to be
+// held until the transaction is rolled back or finished. It returns false if
+// another process holds the lock, or finished the transaction and removed
+// its dir in the meantime.
+func lockLeftover(dir string) (*os.File, bool) {
+	path := filepath.Join(dir, lockName)
+	f, err := os.Open(path)
+	if err != nil {
+		// A dir without a lock file was never locked to begin with.
+		_, statErr := os.Stat(dir)
+		return nil, os.IsNotExist(err) && statErr == nil
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, false
+	}
+	held, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, false
+	}
+	if current, err := os.Stat(path); err != nil || !os.SameFile(held, current) {
+		f.Close()
+		return nil, false
+	}
+	return f, true
+}
+
+// transactionBusy reports whether a running process holds the lock of the
+// transaction in dir.
+func transactionBusy(dir string, pid int) bool {
+	f, err := os.Open(filepath.Join(dir, lockName))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return false
+	}
+	return errors.Is(err, syscall.EWOULDBLOCK)
+}
@@ -0,0 +1,35 @@
+//go:build !unix || aix || solaris
+
+package ops
+
+import "os"
+
+func lockTransaction(dir string) (*os.File, error) {
+	return nil, nil
+}
+
+// lockHistory has no lock to take without flock.
+func lockHistory(dir string) (func(), error) {
+	return func() {}, nil
+}
+
+// lockLeftover has no lock to take, as transactionBusy already went by the
+// process ID.
+func lockLeftover(dir string) (*os.File, bool) {
+	return nil, true
+}
+
+// transactionBusy reports whether the process that began the transaction in
+// dir may still be running. Without flock this goes by its process ID,
+// which on Windows can no longer be opened once the process has exited.
+func transactionBusy(dir string, pid int) bool {
+	if pid == 0 || pid == os.Getpid() {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,172 @@
+package ops
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/electr1fy0/sorta/internal/hash"
+)
+
+// errorNotSameDevice is ERROR_NOT_SAME_DEVICE, which os.Rename returns on
+// Windows instead of EXDEV when moving across volumes.
+const errorNotSameDevice = syscall.Errno(17)
+
+// moveFile renames src to dst. When they live on different filesystems it
+// falls back to copying, verifying the copy's SHA-256 against the source and
+// only then removing the source. Directories are moved recursively.
+//
+// A copy is made under a temporary name and renamed to dst once complete,
+// so dst only ever appears whole, and a failed copy cleans up only what it
+// created.
+func moveFile(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s: %w", dst, os.ErrExist)
+	}
+	if !info.IsDir() {
+		if err := copyTree(src, dst, info); err != nil {
+			return fmt.Errorf("cross-device copy failed: %w", err)
+		}
+		return os.Remove(src)
+	}
+
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".sorta-tmp-*")
+	if err != nil {
+		return err
+	}
+	if err := copyDir(src, tmp, info); err != nil {
+		_ = os.RemoveAll(tmp)
+		return fmt.Errorf("cross-device copy failed: %w", err)
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		_ = os.RemoveAll(tmp)
+		return fmt.Errorf("%s: %w", dst, os.ErrExist)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.RemoveAll(tmp)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func isCrossDevice(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	return errno == syscall.EXDEV || (runtime.GOOS == "windows" && errno == errorNotSameDevice)
+}
+
+func copyTree(src, dst string, info fs.FileInfo) error {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+
+	case info.IsDir():
+		if err := os.Mkdir(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return copyDir(src, dst, info)
+
+	case info.Mode().IsRegular():
+		return copyVerified(src, dst, info)
+
+	default:
+		return fmt.Errorf("cannot copy special file %s", src)
+	}
+}
+
+// copyDir copies the contents of the directory src into the existing
+// directory dst.
+func copyDir(src, dst string, info fs.FileInfo) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		childInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if err := copyTree(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), childInfo); err != nil {
+			return err
+		}
+	}
+	return preserveMetadata(src, dst, info)
+}
+
+// copyVerified streams src into a temporary file next to dst, hashing the
+// source as it goes, then checks the written file hashes the same before
+// putting it in place.
+func copyVerified(src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".sorta-tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	copied, err := hash.FileSum(tmpPath)
+	if err != nil {
+		return err
+	}
+	if want := fmt.Sprintf("%x", h.Sum(nil)); copied != want {
+		return fmt.Errorf("checksum mismatch copying %s: source %s, copy %s", src, want, copied)
+	}
+
+	if err := preserveMetadata(src, tmpPath, info); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s: %w", dst, os.ErrExist)
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+func preserveMetadata(src, dst string, info fs.FileInfo) error {
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := copyXattrs(src, dst); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
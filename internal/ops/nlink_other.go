@@ -0,0 +1,9 @@
+//go:build !unix
+
+package ops
+
+// LinkCount treats every file as having a single link where the count
+// isn't available.
+func LinkCount(path string) uint64 {
+	return 1
+}
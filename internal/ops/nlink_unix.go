@@ -0,0 +1,22 @@
+//go:build unix
+
+package ops
+
+import (
+	"os"
+	"syscall"
+)
+
+// LinkCount returns the number of hardlinks to path, or 0 if it can't be
+// read.
+func LinkCount(path string) uint64 {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1
+	}
+	return uint64(stat.Nlink)
+}
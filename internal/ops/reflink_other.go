@@ -0,0 +1,9 @@
+//go:build !linux
+
+package ops
+
+import "errors"
+
+func reflink(_, _ string) error {
+	return errors.New("reflinks are only supported on Linux")
+}
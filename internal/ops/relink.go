@@ -0,0 +1,99 @@
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/electr1fy0/sorta/internal/core"
+)
+
+func isRelink(t core.OperationType) bool {
+	return t == core.OpRelinkHard || t == core.OpRelinkReflink
+}
+
+// applyRelink replaces a duplicate with a link to its keeper. The duplicate
+// is staged into the transaction dir first, so a failure puts it back and
+// the space is only freed once the whole transaction has succeeded.
+func applyRelink(op core.FileOperation, tx *transaction) (bool, error) {
+	src, keeper := op.File.SourcePath, op.DestPath
+	if keeper == "" || keeper == src {
+		return false, fmt.Errorf("cannot relink %s: no keeper", src)
+	}
+
+	staged := tx.stage("relinked", filepath.Base(src))
+	if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+		return false, err
+	}
+	// Whatever is at src once the duplicate is staged is the link, or part
+	// of it, so the rollback replaces it.
+	rollback := []rollbackAction{{From: staged, To: src, Replace: true}}
+	if err := tx.intend(rollback); err != nil {
+		return false, err
+	}
+	if err := moveFile(src, staged); err != nil {
+		tx.done(nil)
+		return false, fmt.Errorf("failed to stage duplicate: %w", err)
+	}
+	tx.done(rollback)
+
+	if err := link(op.OpType, keeper, src, staged); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// link creates path as a hardlink or reflink of keeper. For reflinks the
+// metadata of original, the file being replaced, is carried over.
+func link(t core.OperationType, keeper, path, original string) error {
+	if t == core.OpRelinkHard {
+		if err := os.Link(keeper, path); err != nil {
+			return fmt.Errorf("failed to hardlink: %w", err)
+		}
+		return nil
+	}
+
+	if err := reflink(keeper, path); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) || errors.Is(err, syscall.EXDEV) || errors.Is(err, syscall.EINVAL) {
+			return fmt.Errorf("failed to reflink (both files must be on one filesystem that supports reflinks, such as btrfs or xfs): %w", err)
+		}
+		return fmt.Errorf("failed to reflink: %w", err)
+	}
+	info, err := os.Stat(original)
+	if err != nil {
+		return err
+	}
+	return preserveMetadata(original, path, info)
+}
+
+// unshare turns a relinked path back into an independent file by copying
+// the shared data, restoring the mode and modification time it had before
+// it was relinked.
+func unshare(op core.FileOperation) error {
+	path := op.File.SourcePath
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".sorta-unshare")
+	_ = os.Remove(tmp)
+	if err := copyVerified(path, tmp, info); err != nil {
+		return err
+	}
+	if op.File.Mode != 0 {
+		if err := os.Chmod(tmp, op.File.Mode.Perm()); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if !op.File.ModTime.IsZero() {
+		if err := os.Chtimes(tmp, op.File.ModTime, op.File.ModTime); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
@@ -25,18 +25,47 @@ func (r *Reporter) Report(op core.FileOperation, err error) {
 
 	tag = ansiGreen + "[OK] " + ansiReset
 
+	note := ""
+	if n := op.ConflictNote(); n != "" {
+		note = " [" + n + "]"
+	}
+
+	if op.Keeper != "" {
+		keeper, err := filepath.Rel(op.File.RootDir, op.Keeper)
+		if err != nil {
+			keeper = op.Keeper
+		}
+		note += " [keeps " + keeper + "]"
+	}
+	if createsCopy(op.OpType) {
+		note = " [" + verb(op.OpType) + "]" + note
+	}
+
 	switch op.OpType {
-	case core.OpMove, core.OpRename, core.OpDedupe:
+	case core.OpMove, core.OpRename, core.OpDedupe, core.OpCopy, core.OpSymlink, core.OpHardlink:
 		srcDir := filepath.Dir(op.File.SourcePath)
 		destDir := filepath.Dir(op.DestPath)
 
 		if srcDir == destDir {
 			newFilename := filepath.Base(op.DestPath)
-			fmt.Printf("%s %s -> %s (%s)\n", tag, filepath.Base(op.File.SourcePath), newFilename, core.HumanReadable(op.Size))
+			fmt.Printf("%s %s -> %s (%s)%s\n", tag, filepath.Base(op.File.SourcePath), newFilename, core.HumanReadable(op.Size), note)
 		} else {
 			destDirName := filepath.Base(destDir)
-			fmt.Printf("%s %s -> %s/ (%s)\n", tag, filepath.Base(op.File.SourcePath), destDirName, core.HumanReadable(op.Size))
+			fmt.Printf("%s %s -> %s/ (%s)%s\n", tag, filepath.Base(op.File.SourcePath), destDirName, core.HumanReadable(op.Size), note)
+		}
+	case core.OpRelinkHard, core.OpRelinkReflink:
+		keeper, err := filepath.Rel(op.File.RootDir, op.DestPath)
+		if err != nil {
+			keeper = op.DestPath
+		}
+		kind := "hardlink"
+		if op.OpType == core.OpRelinkReflink {
+			kind = "reflink"
+		}
+		if op.Size > 0 {
+			kind += ", " + core.HumanReadable(op.Size) + " reclaimed"
 		}
+		fmt.Printf("%s %s => %s (%s)\n", tag, filepath.Base(op.File.SourcePath), keeper, kind)
 	case core.OpDelete:
 		tag = ansiRed + "[DEL]" + ansiReset
 		fmt.Printf("%s %s (%s)\n", tag, filepath.Base(op.File.SourcePath), core.HumanReadable(op.Size))
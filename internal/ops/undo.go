@@ -0,0 +1,408 @@
+package ops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/electr1fy0/sorta/internal/core"
+	"github.com/electr1fy0/sorta/internal/hash"
+	"github.com/electr1fy0/sorta/internal/trash"
+)
+
+// conflict is an operation undo leaves alone because its files changed
+// after it was applied. It is reported rather than failing the undo.
+type conflict struct {
+	path   string
+	reason string
+}
+
+func (c *conflict) Error() string {
+	return c.path + ": " + c.reason
+}
+
+// UndoOptions selects what Undo reverts. By default it is the latest
+// transaction on the directory still in effect.
+type UndoOptions struct {
+	// ID names a transaction to undo instead.
+	ID string
+	// Steps undoes this many of the latest transactions, newest first.
+	Steps int
+	// Force undoes ID even when later transactions touched its files.
+	Force bool
+}
+
+// Undo reverts transactions on path as chosen by opts, each as an undo
+// transaction of its own, and returns the ones it reverted.
+func Undo(path string, opts UndoOptions) ([]core.Transaction, *core.SortResult, error) {
+	result := &core.SortResult{}
+	if !filepath.IsAbs(path) {
+		var err error
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return nil, result, err
+		}
+	}
+	tl, err := loadTimeline(path)
+	if err != nil {
+		return nil, result, err
+	}
+
+	var targets []core.Transaction
+	if opts.ID != "" {
+		t, ok := tl.find(opts.ID)
+		if !ok || !onRoot(t, path) {
+			return nil, result, fmt.Errorf("%w: no transaction %s on %s", ErrNoHistory, opts.ID, path)
+		}
+		if t.TType == core.TUndo {
+			return nil, result, fmt.Errorf("%s is an undo; use redo to revert it", t.ID)
+		}
+		if by := tl.revertedBy[t.ID]; by != "" {
+			return nil, result, fmt.Errorf("%s was already reverted by %s: %w", t.ID, by, ErrAlreadyUndone)
+		}
+		if later, ok := tl.touchedLater(t); ok && !opts.Force {
+			return nil, result, fmt.Errorf("%w: %s changed files from %s", ErrTouchedLater, later.ID, t.ID)
+		}
+		targets = []core.Transaction{tl.remaining(t)}
+	} else {
+		var ok bool
+		targets, ok = tl.latest(path, max(opts.Steps, 1))
+		if !ok {
+			if slices.ContainsFunc(tl.txns, func(t core.Transaction) bool { return onRoot(t, path) }) {
+				return nil, result, fmt.Errorf("every operation in %s was already undone: %w", path, ErrAlreadyUndone)
+			}
+			return nil, result, fmt.Errorf("%w: %s", ErrNoHistory, path)
+		}
+	}
+
+	var undone []core.Transaction
+	for _, t := range targets {
+		if t.Irreversible {
+			return undone, result, fmt.Errorf("cannot undo irreversible operation %s (e.g. used --nuke --permanent)", t.ID)
+		}
+		if err := undoTransaction(t, result); err != nil {
+			return undone, result, err
+		}
+		undone = append(undone, t)
+	}
+	return undone, result, nil
+}
+
+// Redo reverts the latest undo on path, applying the operations it undid
+// again, and returns that undo. Redo is only possible until another
+// operation is run on path.
+func Redo(ctx context.Context, path string, executor *Executor, reporter *Reporter) (core.Transaction, *core.SortResult, error) {
+	if !filepath.IsAbs(path) {
+		var err error
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return core.Transaction{}, nil, err
+		}
+	}
+	tl, err := loadTimeline(path)
+	if err != nil {
+		return core.Transaction{}, nil, err
+	}
+	u, ok := tl.redoable(path)
+	if !ok {
+		return core.Transaction{}, nil, fmt.Errorf("%w in %s", ErrNothingToRedo, path)
+	}
+
+	// The undo holds the operations it reverted in their original order,
+	// without the ones it left alone.
+	executor.DestRoot = u.DestRoot
+	result, err := applyOperations(ctx, u.RootDir(), u.Operations, executor, reporter, u.ID)
+	return u, result, err
+}
+
+// checkRedo reports why op can't be applied again as it was recorded: its
+// source changed or is gone, or its destination has been taken meanwhile.
+func checkRedo(op core.FileOperation) error {
+	if err := checkUnchanged(op.File.SourcePath, op.File, nil); err != nil {
+		return err
+	}
+	switch op.OpType {
+	case core.OpMove, core.OpRename, core.OpDedupe, core.OpCopy, core.OpSymlink, core.OpHardlink:
+		if err := checkFree(op.DestPath); err != nil {
+			return &conflict{op.DestPath, "destination is occupied"}
+		}
+	}
+	if needsVerify(op) {
+		if err := verifyDuplicate(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// undoTransaction reverts t as a transaction of its own, adding to result:
+// every file is checked against what t recorded before it is touched,
+// anything that changed since is reported as a conflict and left alone, and
+// a failure rolls back whatever had already been undone.
+func undoTransaction(t core.Transaction, result *core.SortResult) error {
+	rootDir := t.RootDir()
+	if rootDir == "" {
+		return fmt.Errorf("transaction %s has no root directory", t.ID)
+	}
+	tx, err := beginTransaction(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to create transaction dir: %w", err)
+	}
+
+	// Later operations may depend on earlier ones, such as a nuke trashing
+	// files that were just moved into duplicates/, so undo runs backwards.
+	var undone []core.FileOperation
+	vacated := make(map[string]bool)
+	for _, op := range slices.Backward(t.Operations) {
+		if op.OpType == core.OpSkip {
+			continue
+		}
+		err := undoOperation(op, tx)
+		var c *conflict
+		if errors.As(err, &c) {
+			result.Conflicts = append(result.Conflicts, c)
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", filepath.Base(op.File.SourcePath), err))
+			return tx.fail(fmt.Errorf("failed to undo operations: %w", err))
+		}
+		undone = append(undone, op)
+		if op.DestPath != "" && op.OpType != core.OpDelete && !isRelink(op.OpType) {
+			vacated[filepath.Dir(op.DestPath)] = true
+		}
+
+		switch op.OpType {
+		case core.OpMove:
+			result.Moved++
+		case core.OpRename:
+			result.Renamed++
+		case core.OpDedupe:
+			result.Deduped++
+		case core.OpCopy, core.OpSymlink, core.OpHardlink:
+			result.Deleted++
+		case core.OpRelinkHard, core.OpRelinkReflink:
+			result.Copied++
+		case core.OpDelete:
+			result.Restored++
+		}
+	}
+
+	// Folders the operations created are removed once empty again, and
+	// the ones the transaction cleaned away come back.
+	for dir := range vacated {
+		if dir != t.DestRoot {
+			removeEmptyParents(dir, rootDir)
+		}
+	}
+	for _, dir := range t.RemovedDirs {
+		if _, err := os.Lstat(dir); !os.IsNotExist(err) {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return tx.fail(fmt.Errorf("failed to recreate %s: %w", dir, err))
+		}
+		if err := tx.record([]rollbackAction{{Remove: dir}}); err != nil {
+			return tx.fail(err)
+		}
+	}
+
+	if len(undone) > 0 {
+		// Logged in their original order, so redo can apply them again.
+		slices.Reverse(undone)
+		transaction := core.Transaction{
+			TType:      core.TUndo,
+			Operations: undone,
+			ID:         tx.id,
+			Root:       rootDir,
+			DestRoot:   t.DestRoot,
+			Reverts:    t.ID,
+		}
+		if err := LogToHistory(transaction); err != nil {
+			return tx.fail(fmt.Errorf("failed to log history: %w", err))
+		}
+	}
+	return tx.commit()
+}
+
+// undoOperation reverts a single operation as a step of tx, logging how to
+// redo it should the undo have to be rolled back.
+func undoOperation(op core.FileOperation, tx *transaction) error {
+	src, dest := op.File.SourcePath, op.DestPath
+	switch op.OpType {
+	case core.OpMove, core.OpRename, core.OpDedupe:
+		if err := checkUnchanged(dest, op.File, op.Placed); err != nil {
+			return err
+		}
+		if err := checkFree(src); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(src), 0755); err != nil {
+			return err
+		}
+		rollback := []rollbackAction{{From: src, To: dest}}
+		if err := tx.intend(rollback); err != nil {
+			return err
+		}
+		if err := moveFile(dest, src); err != nil {
+			tx.done(nil)
+			return fmt.Errorf("failed to move back: %w", err)
+		}
+		tx.done(rollback)
+		return nil
+
+	case core.OpCopy, core.OpSymlink, core.OpHardlink:
+		if err := checkCreated(op); err != nil {
+			return err
+		}
+		staged := tx.stage("undone", filepath.Base(dest))
+		if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+			return err
+		}
+		rollback := []rollbackAction{{From: staged, To: dest}}
+		if err := tx.intend(rollback); err != nil {
+			return err
+		}
+		if err := moveFile(dest, staged); err != nil {
+			tx.done(nil)
+			return fmt.Errorf("failed to remove %s: %w", verb(op.OpType), err)
+		}
+		tx.done(rollback)
+		return nil
+
+	case core.OpRelinkHard, core.OpRelinkReflink:
+		info, err := os.Lstat(src)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return &conflict{src, "missing"}
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() || info.Size() != op.File.Size {
+			return &conflict{src, "changed since it was relinked"}
+		}
+		// Keep the link aside, so a rollback can put it back.
+		var rollback []rollbackAction
+		staged := tx.stage("unshared", filepath.Base(src))
+		if err := os.MkdirAll(filepath.Dir(staged), 0755); err == nil && os.Link(src, staged) == nil {
+			rollback = append(rollback, rollbackAction{From: staged, To: src, Replace: true})
+		}
+		if err := tx.intend(rollback); err != nil {
+			return err
+		}
+		tx.done(rollback)
+		if err := unshare(op); err != nil {
+			return fmt.Errorf("failed to unshare: %w", err)
+		}
+		return nil
+
+	case core.OpDelete:
+		if dest == "" {
+			return &conflict{src, "was deleted permanently"}
+		}
+		item, err := trash.Lookup(dest)
+		if errors.Is(err, trash.ErrNotTrashed) {
+			return &conflict{src, "no longer in the trash"}
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkFree(src); err != nil {
+			return err
+		}
+		rollback := []rollbackAction{{Trash: src}}
+		if err := tx.intend(rollback); err != nil {
+			return err
+		}
+		if err := trash.Restore(item, src); err != nil {
+			tx.done(nil)
+			return fmt.Errorf("failed to restore from trash: %w", err)
+		}
+		tx.done(rollback)
+		return nil
+	}
+	return fmt.Errorf("unsupported operation type: %v", op.OpType)
+}
+
+// checkUnchanged reports a conflict unless path still matches the size and
+// modification time recorded for want and, if id is known, is still that
+// file. Folders are compared by modification time and id only.
+func checkUnchanged(path string, want core.FileEntry, id *core.FileID) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &conflict{path, "missing"}
+		}
+		return err
+	}
+	if id != nil {
+		if fp := hash.FingerprintOf(info); fp.Device != id.Device || fp.Inode != id.Inode {
+			return &conflict{path, "replaced by another file since the operation"}
+		}
+	}
+	if want.ModTime.IsZero() {
+		return nil
+	}
+	if (info.Mode().IsRegular() && info.Size() != want.Size) || !info.ModTime().Equal(want.ModTime) {
+		return &conflict{path, "changed since the operation"}
+	}
+	return nil
+}
+
+// placesFile reports whether operations of type t leave a file of their
+// own at the destination, which undo has to find unchanged.
+func placesFile(t core.OperationType) bool {
+	switch t {
+	case core.OpMove, core.OpRename, core.OpDedupe, core.OpCopy, core.OpHardlink:
+		return true
+	}
+	return false
+}
+
+// fileID returns the device and inode of path, or nil if they aren't
+// available.
+func fileID(path string) *core.FileID {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	fp := hash.FingerprintOf(info)
+	if fp.Inode == 0 {
+		return nil
+	}
+	return &core.FileID{Device: fp.Device, Inode: fp.Inode}
+}
+
+// checkCreated reports a conflict unless op's destination is still the copy
+// or link op created.
+func checkCreated(op core.FileOperation) error {
+	dest := op.DestPath
+	if op.OpType != core.OpSymlink {
+		return checkUnchanged(dest, op.File, op.Placed)
+	}
+	target, err := os.Readlink(dest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &conflict{dest, "missing"}
+		}
+		return &conflict{dest, "no longer a symlink"}
+	}
+	if want, err := filepath.Abs(op.File.SourcePath); err != nil || target != want {
+		return &conflict{dest, "points somewhere else now"}
+	}
+	return nil
+}
+
+// checkFree reports a conflict if something now occupies path.
+func checkFree(path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return &conflict{path, "original path is occupied"}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
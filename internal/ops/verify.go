@@ -0,0 +1,135 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/electr1fy0/sorta/internal/core"
+)
+
+// needsVerify reports whether op removes or replaces a duplicate on the
+// strength of its keeper having the same contents.
+func needsVerify(op core.FileOperation) bool {
+	if op.Keeper == "" {
+		return false
+	}
+	return op.OpType == core.OpDedupe || isRelink(op.OpType)
+}
+
+// isDir reports whether path is a directory itself, not a link to one.
+func isDir(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir()
+}
+
+// verifyDuplicate compares op's file with its keeper byte for byte and
+// returns an error describing the first difference, if any. A duplicate
+// directory is checked file by file against the same paths in the keeper.
+func verifyDuplicate(op core.FileOperation) error {
+	info, err := os.Stat(op.File.SourcePath)
+	if err != nil {
+		return fmt.Errorf("%s: cannot verify: %w", op.File.SourcePath, err)
+	}
+	if info.IsDir() {
+		return verifyTree(op.File.SourcePath, op.Keeper)
+	}
+
+	same, err := sameContent(op.File.SourcePath, op.Keeper)
+	if err != nil {
+		return fmt.Errorf("%s: cannot verify against %s: %w", op.File.SourcePath, op.Keeper, err)
+	}
+	if !same {
+		return fmt.Errorf("%s: contents differ from %s", op.File.SourcePath, op.Keeper)
+	}
+	return nil
+}
+
+// verifyTree checks that every file below dir exists in keeper at the same
+// relative path with the same contents.
+func verifyTree(dir, keeper string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("%s: cannot verify: %w", path, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		other := filepath.Join(keeper, rel)
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			a, errA := os.Readlink(path)
+			b, errB := os.Readlink(other)
+			if errA != nil || errB != nil || a != b {
+				return fmt.Errorf("%s: symlink differs from %s", path, other)
+			}
+			return nil
+		}
+		same, err := sameContent(path, other)
+		if err != nil {
+			return fmt.Errorf("%s: cannot verify against %s: %w", path, other, err)
+		}
+		if !same {
+			return fmt.Errorf("%s: contents differ from %s", path, other)
+		}
+		return nil
+	})
+}
+
+// sameContent streams a and b side by side and reports whether they hold
+// the same bytes.
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	ia, err := fa.Stat()
+	if err != nil {
+		return false, err
+	}
+	ib, err := fb.Stat()
+	if err != nil {
+		return false, err
+	}
+	if ia.Size() != ib.Size() {
+		return false, nil
+	}
+	if os.SameFile(ia, ib) {
+		return true, nil
+	}
+
+	bufA := make([]byte, 64*1024)
+	bufB := make([]byte, 64*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		doneA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		doneB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !doneA {
+			return false, errA
+		}
+		if errB != nil && !doneB {
+			return false, errB
+		}
+		if doneA || doneB {
+			return doneA == doneB, nil
+		}
+	}
+}
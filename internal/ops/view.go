@@ -0,0 +1,192 @@
+package ops
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/electr1fy0/sorta/internal/core"
+)
+
+// viewMarker is written into every view directory. It names the directory
+// the view mirrors, and SyncView refuses to touch directories without it.
+const viewMarker = ".sorta-view"
+
+type ViewResult struct {
+	Added   int
+	Removed int
+	Kept    int
+	Errors  []error
+}
+
+// PlanView lays out a view of rootDir: for every file, the path relative to
+// the view where its link goes, mapped to the file the link points at.
+// Files the plan would place somewhere show up there; everything else keeps
+// its current relative path.
+func PlanView(rootDir, destRoot string, files []core.FileEntry, operations []core.FileOperation) map[string]string {
+	if destRoot == "" {
+		destRoot = rootDir
+	}
+
+	placed := make(map[string]core.FileOperation, len(operations))
+	for _, op := range operations {
+		if op.DestPath == "" || op.File.SourcePath == "" {
+			continue
+		}
+		switch op.OpType {
+		case core.OpMove, core.OpRename, core.OpDedupe, core.OpCopy, core.OpSymlink, core.OpHardlink:
+			placed[op.File.SourcePath] = op
+		}
+	}
+
+	links := make(map[string]string, len(files))
+	// add links rel to path unless rel is already taken. A file that would
+	// replace whatever sits at its destination takes the slot regardless.
+	add := func(rel, path string, replaces bool) {
+		if _, taken := links[rel]; taken && !replaces {
+			return
+		}
+		links[rel] = path
+	}
+
+	for _, file := range files {
+		rel, err := filepath.Rel(rootDir, file.SourcePath)
+		if err != nil {
+			continue
+		}
+		op, ok := placed[file.SourcePath]
+		if !ok {
+			add(rel, file.SourcePath, false)
+			continue
+		}
+		destRel, err := filepath.Rel(destRoot, op.DestPath)
+		if err != nil || strings.HasPrefix(destRel, "..") {
+			add(rel, file.SourcePath, false)
+			continue
+		}
+		if createsCopy(op.OpType) {
+			// The original stays put, so it shows up in both places.
+			add(rel, file.SourcePath, false)
+		}
+		add(destRel, file.SourcePath, op.Resolution == core.ResolveReplaced)
+	}
+	return links
+}
+
+// SyncView makes outDir hold exactly the symlinks in links. Links that
+// already point at the right file are kept, stale ones are removed and
+// missing ones are created. Only symlinks, and folders left empty once they
+// are gone, are ever removed; anything else found in outDir is left alone.
+func SyncView(outDir, rootDir string, links map[string]string, dryRun bool) (*ViewResult, error) {
+	result := &ViewResult{}
+	if err := claimViewDir(outDir, rootDir, dryRun); err != nil {
+		return result, err
+	}
+
+	want := make(map[string]string, len(links))
+	for rel, target := range links {
+		want[rel] = target
+	}
+
+	walkErr := filepath.WalkDir(outDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == outDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(outDir, path)
+		if err != nil {
+			return err
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if want[rel] == target {
+			delete(want, rel)
+			result.Kept++
+			return nil
+		}
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("%s: %w", rel, err))
+				return nil
+			}
+		}
+		result.Removed++
+		return nil
+	})
+	if walkErr != nil {
+		return result, fmt.Errorf("failed to read view: %w", walkErr)
+	}
+
+	rels := make([]string, 0, len(want))
+	for rel := range want {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	for _, rel := range rels {
+		result.Added++
+		if dryRun {
+			continue
+		}
+		path := filepath.Join(outDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", rel, err))
+			result.Added--
+			continue
+		}
+		if err := os.Symlink(want[rel], path); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("%s: %w", rel, err))
+			result.Added--
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if _, err := cleanEmptyFolders(outDir); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// claimViewDir makes sure outDir is a view of rootDir, creating it and its
+// marker when it is new. A non-empty directory without a marker, or a view
+// of some other directory, is refused.
+func claimViewDir(outDir, rootDir string, dryRun bool) error {
+	markerPath := filepath.Join(outDir, viewMarker)
+	data, err := os.ReadFile(markerPath)
+	if err == nil {
+		if owner := strings.TrimSpace(string(data)); owner != rootDir {
+			return fmt.Errorf("%s is a view of %s, not %s", outDir, owner, rootDir)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	entries, err := os.ReadDir(outDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("%s is not empty and is not a sorta view", outDir)
+	}
+	if dryRun {
+		return nil
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	return core.WriteFileAtomic(markerPath, []byte(rootDir+"\n"), 0644)
+}
@@ -0,0 +1,58 @@
+//go:build linux
+
+package ops
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+)
+
+func copyXattrs(src, dst string) error {
+	size, err := syscall.Listxattr(src, nil)
+	if err != nil || size == 0 {
+		return ignoreUnsupported(err)
+	}
+	buf := make([]byte, size)
+	size, err = syscall.Listxattr(src, buf)
+	if err != nil {
+		return ignoreUnsupported(err)
+	}
+
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		value, err := getxattr(src, attr)
+		if err == nil {
+			err = syscall.Setxattr(dst, attr, value, 0)
+		}
+		if err := ignoreUnsupported(err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getxattr(path, attr string) ([]byte, error) {
+	n, err := syscall.Getxattr(path, attr, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, n)
+	n, err = syscall.Getxattr(path, attr, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:n], nil
+}
+
+// ignoreUnsupported drops errors from filesystems without xattr support or
+// attributes an unprivileged user may not set (e.g. security.*).
+func ignoreUnsupported(err error) error {
+	if err == nil || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ENODATA) {
+		return nil
+	}
+	return err
+}
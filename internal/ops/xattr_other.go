@@ -0,0 +1,7 @@
+//go:build !linux
+
+package ops
+
+func copyXattrs(_, _ string) error {
+	return nil
+}
@@ -0,0 +1,116 @@
+package sniff
+
+import (
+	"bytes"
+)
+
+type signature struct {
+	offset int
+	magic  []byte
+	mime   string
+}
+
+var signatures = []signature{
+	{0, []byte("7z\xBC\xAF\x27\x1C"), "application/x-7z-compressed"},
+	{0, []byte("\xFD7zXZ\x00"), "application/x-xz"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\x28\xB5\x2F\xFD"), "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("!<arch>\ndebian"), "application/vnd.debian.binary-package"},
+	{0, []byte("\xED\xAB\xEE\xDB"), "application/x-rpm"},
+	{0, []byte("\x7FELF"), "application/x-elf"},
+	{0, []byte("\xCF\xFA\xED\xFE"), "application/x-mach-binary"},
+	{0, []byte("\xCE\xFA\xED\xFE"), "application/x-mach-binary"},
+	{0, []byte("\xCA\xFE\xBA\xBE"), "application/x-mach-binary"},
+	{0, []byte("MZ"), "application/vnd.microsoft.portable-executable"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{0, []byte("{\\rtf"), "application/rtf"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("8BPS"), "image/vnd.adobe.photoshop"},
+	{30, []byte("mimetypeapplication/epub+zip"), "application/epub+zip"},
+	{30, []byte("mimetypeapplication/vnd.oasis.opendocument.text"), "application/vnd.oasis.opendocument.text"},
+	{30, []byte("mimetypeapplication/vnd.oasis.opendocument.spreadsheet"), "application/vnd.oasis.opendocument.spreadsheet"},
+	{30, []byte("mimetypeapplication/vnd.oasis.opendocument.presentation"), "application/vnd.oasis.opendocument.presentation"},
+}
+
+var ftypBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"avif": "image/avif",
+	"qt  ": "video/quicktime",
+	"M4A ": "audio/mp4",
+	"M4B ": "audio/mp4",
+	"3gp4": "video/3gpp",
+	"3gp5": "video/3gpp",
+}
+
+var officeParts = []struct {
+	marker []byte
+	mime   string
+}{
+	{[]byte("word/"), "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{[]byte("xl/"), "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{[]byte("ppt/"), "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+}
+
+var kinds = map[string]string{
+	"application/zip":                                 "archive",
+	"application/x-gzip":                              "archive",
+	"application/x-rar-compressed":                    "archive",
+	"application/x-7z-compressed":                     "archive",
+	"application/x-xz":                                "archive",
+	"application/x-bzip2":                             "archive",
+	"application/zstd":                                "archive",
+	"application/x-tar":                               "archive",
+	"application/vnd.debian.binary-package":           "archive",
+	"application/x-rpm":                               "archive",
+	"application/pdf":                                 "document",
+	"application/postscript":                          "document",
+	"application/rtf":                                 "document",
+	"application/epub+zip":                            "document",
+	"application/msword":                              "document",
+	"application/vnd.oasis.opendocument.text":         "document",
+	"application/vnd.oasis.opendocument.spreadsheet":  "document",
+	"application/vnd.oasis.opendocument.presentation": "document",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   "document",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":         "document",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": "document",
+	"application/x-elf":                             "executable",
+	"application/x-mach-binary":                     "executable",
+	"application/vnd.microsoft.portable-executable": "executable",
+	"application/wasm":                              "executable",
+	"application/ogg":                               "audio",
+}
+
+func detectExtra(data []byte) string {
+	for _, sig := range signatures {
+		end := sig.offset + len(sig.magic)
+		if len(data) >= end && bytes.Equal(data[sig.offset:end], sig.magic) {
+			return sig.mime
+		}
+	}
+
+	if len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")) {
+		if mime, ok := ftypBrands[string(data[8:12])]; ok {
+			return mime
+		}
+	}
+
+	if bytes.HasPrefix(data, []byte("\x1A\x45\xDF\xA3")) && bytes.Contains(data, []byte("matroska")) {
+		return "video/x-matroska"
+	}
+
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) && bytes.Contains(data, []byte("[Content_Types].xml")) {
+		for _, part := range officeParts {
+			if bytes.Contains(data, part.marker) {
+				return part.mime
+			}
+		}
+	}
+
+	return ""
+}
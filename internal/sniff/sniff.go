@@ -0,0 +1,100 @@
+package sniff
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/electr1fy0/sorta/internal/core"
+)
+
+// HeadSize is how much of each file is read for type detection and for the
+// partial hash used by the duplicate finder.
+const HeadSize = 4096
+
+const maxCached = 1 << 16
+
+// Info is what sorta learns from the first HeadSize bytes of a file.
+type Info struct {
+	Type    string
+	Partial string
+}
+
+type cacheKey struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+var (
+	mu    sync.Mutex
+	cache = make(map[cacheKey]Info)
+)
+
+// Head reads the start of file once per run and returns its content type and
+// partial hash, so sorting and deduping the same tree share a single read.
+func Head(file core.FileEntry) (Info, error) {
+	key := cacheKey{path: file.SourcePath, size: file.Size, modTime: file.ModTime.UnixNano()}
+
+	mu.Lock()
+	info, ok := cache[key]
+	mu.Unlock()
+	if ok {
+		return info, nil
+	}
+
+	f, err := os.Open(file.SourcePath)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, HeadSize)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Info{}, err
+	}
+	info = Info{
+		Type:    Detect(buf[:n]),
+		Partial: fmt.Sprintf("%x", sha256.Sum256(buf[:n])),
+	}
+
+	mu.Lock()
+	if len(cache) >= maxCached {
+		cache = make(map[cacheKey]Info)
+	}
+	cache[key] = info
+	mu.Unlock()
+	return info, nil
+}
+
+// Detect returns the MIME type of data without parameters. Formats that
+// http.DetectContentType does not know about are checked first.
+func Detect(data []byte) string {
+	if t := detectExtra(data); t != "" {
+		return t
+	}
+	t := http.DetectContentType(data)
+	if i := strings.IndexByte(t, ';'); i >= 0 {
+		t = t[:i]
+	}
+	return strings.TrimSpace(t)
+}
+
+// Kind maps a MIME type to a broad category: image, video, audio, font,
+// text, archive, document, executable or other.
+func Kind(mime string) string {
+	if k, ok := kinds[mime]; ok {
+		return k
+	}
+	prefix, _, _ := strings.Cut(mime, "/")
+	switch prefix {
+	case "image", "video", "audio", "font", "text":
+		return prefix
+	}
+	return "other"
+}
@@ -10,6 +10,7 @@ import (
 
 type ConfigSorter struct {
 	configData *config.ConfigData
+	destRoot   string
 }
 
 func NewConfigSorter(folderPath, configPath, inline string) (*ConfigSorter, error) {
@@ -25,7 +26,31 @@ func NewConfigSorter(folderPath, configPath, inline string) (*ConfigSorter, erro
 	if err != nil {
 		return nil, err
 	}
-	return &ConfigSorter{configData: confData}, nil
+
+	s := &ConfigSorter{configData: confData}
+	if confData.Root != "" {
+		root, err := core.ExpandPath(confData.Root)
+		if err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(folderPath, root)
+		}
+		s.destRoot = filepath.Clean(root)
+	}
+	return s, nil
+}
+
+// SetDestRoot makes sorted files land under dir instead of the scanned
+// directory, overriding any @root setting in the config.
+func (s *ConfigSorter) SetDestRoot(dir string) {
+	s.destRoot = dir
+}
+
+// DestRoot returns the directory sorted files are placed under, or "" when
+// they stay inside the scanned directory.
+func (s *ConfigSorter) DestRoot() string {
+	return s.destRoot
 }
 
 func (s *ConfigSorter) Decide(ctx context.Context, files []core.FileEntry) ([]core.FileOperation, error) {
@@ -36,16 +61,21 @@ func (s *ConfigSorter) Decide(ctx context.Context, files []core.FileEntry) ([]co
 			return nil, err
 		}
 		filename := filepath.Base(file.SourcePath)
-		destFolder := config.Categorize(*s.configData, filename)
+		destFolder, opts := config.Categorize(*s.configData, file)
+		root := file.RootDir
+		if s.destRoot != "" {
+			root = s.destRoot
+		}
 
 		if destFolder == "" {
 			ops = append(ops, core.FileOperation{OpType: core.OpSkip})
 		} else {
 			ops = append(ops, core.FileOperation{
-				OpType:   core.OpMove,
+				OpType:   opts.Action,
 				File:     file,
 				Size:     file.Size,
-				DestPath: filepath.Join(file.RootDir, destFolder, filename),
+				DestPath: filepath.Join(root, destFolder, filename),
+				Conflict: opts.Conflict,
 			})
 		}
 	}
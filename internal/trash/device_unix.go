@@ -0,0 +1,20 @@
+//go:build unix
+
+package trash
+
+import (
+	"os"
+	"syscall"
+)
+
+func device(path string) (uint64, bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
@@ -0,0 +1,29 @@
+package trash
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// mounts returns the mount points listed in /proc/self/mounts.
+func mounts() []string {
+	f, err := os.Open("/proc/self/mounts")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var tops []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		// Spaces and other special characters are escaped as octal.
+		top := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(fields[1])
+		tops = append(tops, top)
+	}
+	return tops
+}
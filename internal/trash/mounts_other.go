@@ -0,0 +1,8 @@
+//go:build !linux
+
+package trash
+
+// mounts isn't implemented here; only the home trash is listed.
+func mounts() []string {
+	return nil
+}
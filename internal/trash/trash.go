@@ -0,0 +1,331 @@
+// Package trash moves files to the desktop trash as described by the
+// freedesktop.org Trash specification, so they can be restored later by sorta
+// or by a file manager.
+package trash
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	infoExt    = ".trashinfo"
+	dateFormat = "2006-01-02T15:04:05"
+)
+
+var ErrNotTrashed = errors.New("not in the trash")
+
+// Item is one trashed file or directory.
+type Item struct {
+	// Dir is the trash directory holding the item, with files/ and info/
+	// inside it.
+	Dir string
+	// Name is the item's name inside Dir/files.
+	Name         string
+	OriginalPath string
+	DeletedAt    time.Time
+}
+
+// Path is where the item currently lives.
+func (i Item) Path() string {
+	return filepath.Join(i.Dir, "files", i.Name)
+}
+
+func (i Item) infoPath() string {
+	return filepath.Join(i.Dir, "info", i.Name+infoExt)
+}
+
+// HomeDir returns the trash in $XDG_DATA_HOME, by default
+// ~/.local/share/Trash.
+func HomeDir() (string, error) {
+	if data := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(data) {
+		return filepath.Join(data, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// Put moves path to the trash on its filesystem: the home trash if they
+// share a device, otherwise the trash at the top of the file's mount.
+func Put(path string) (Item, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Item{}, err
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return Item{}, err
+	}
+
+	dir, topdir, err := trashFor(path)
+	if err != nil {
+		return Item{}, err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return Item{}, fmt.Errorf("cannot create trash: %w", err)
+		}
+	}
+
+	item := Item{Dir: dir, OriginalPath: path, DeletedAt: time.Now()}
+	recorded := path
+	if topdir != "" {
+		if rel, err := filepath.Rel(topdir, path); err == nil {
+			recorded = rel
+		}
+	}
+
+	// The info file is created first and exclusively, which both claims
+	// the name and makes sure a crash never leaves an unexplained file.
+	info, err := reserve(&item)
+	if err != nil {
+		return Item{}, err
+	}
+	_, err = fmt.Fprintf(info, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: recorded}).EscapedPath(), item.DeletedAt.Format(dateFormat))
+	if closeErr := info.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(path, item.Path())
+	}
+	if err != nil {
+		os.Remove(item.infoPath())
+		return Item{}, fmt.Errorf("cannot move %s to the trash: %w", path, err)
+	}
+	return item, nil
+}
+
+// reserve picks a free name for item and creates its info file.
+func reserve(item *Item) (*os.File, error) {
+	base := filepath.Base(item.OriginalPath)
+	for n := 1; ; n++ {
+		item.Name = base
+		if n > 1 {
+			ext := filepath.Ext(base)
+			item.Name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), n, ext)
+		}
+		f, err := os.OpenFile(item.infoPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			if _, err := os.Lstat(item.Path()); err == nil {
+				f.Close()
+				os.Remove(item.infoPath())
+				continue
+			}
+			return f, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// trashFor returns the trash directory for path and, for a trash at the top
+// of a mount, that mount's top directory.
+func trashFor(path string) (dir, topdir string, err error) {
+	home, err := HomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(home, 0700); err != nil {
+		return "", "", fmt.Errorf("cannot create trash: %w", err)
+	}
+
+	dev, ok := device(path)
+	if !ok {
+		return home, "", nil
+	}
+	if homeDev, ok := device(home); ok && homeDev == dev {
+		return home, "", nil
+	}
+
+	top := mountTop(path, dev)
+	uid := strconv.Itoa(os.Getuid())
+
+	// A shared $topdir/.Trash must have the sticky bit set and not be a
+	// symlink before a per-user directory is made in it.
+	if info, err := os.Lstat(filepath.Join(top, ".Trash")); err == nil &&
+		info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		shared := filepath.Join(top, ".Trash", uid)
+		if err := os.MkdirAll(shared, 0700); err == nil {
+			return shared, top, nil
+		}
+	}
+	own := filepath.Join(top, ".Trash-"+uid)
+	if err := os.MkdirAll(own, 0700); err != nil {
+		return "", "", fmt.Errorf("cannot create trash on %s: %w", top, err)
+	}
+	return own, top, nil
+}
+
+// mountTop walks up from path to the topmost directory on device dev.
+func mountTop(path string, dev uint64) string {
+	top := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(top)
+		if parent == top {
+			return top
+		}
+		if d, ok := device(parent); !ok || d != dev {
+			return top
+		}
+		top = parent
+	}
+}
+
+// Dirs returns the trash directories that exist: the home trash and those at
+// the top of mounted filesystems.
+func Dirs() []string {
+	var dirs []string
+	if home, err := HomeDir(); err == nil {
+		dirs = append(dirs, home)
+	}
+	uid := strconv.Itoa(os.Getuid())
+	for _, top := range mounts() {
+		dirs = append(dirs, filepath.Join(top, ".Trash", uid), filepath.Join(top, ".Trash-"+uid))
+	}
+
+	var existing []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if info, err := os.Stat(filepath.Join(dir, "info")); err == nil && info.IsDir() {
+			existing = append(existing, dir)
+		}
+	}
+	return existing
+}
+
+// List returns every item in every trash directory, oldest first.
+func List() ([]Item, error) {
+	var items []Item
+	for _, dir := range Dirs() {
+		entries, err := os.ReadDir(filepath.Join(dir, "info"))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			name, ok := strings.CutSuffix(e.Name(), infoExt)
+			if !ok {
+				continue
+			}
+			item, err := readInfo(dir, name)
+			if err != nil {
+				continue
+			}
+			items = append(items, item)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.Before(items[j].DeletedAt) })
+	return items, nil
+}
+
+// Lookup returns the item that lives at path, a file directly inside a
+// trash's files/ directory.
+func Lookup(path string) (Item, error) {
+	filesDir := filepath.Dir(path)
+	if filepath.Base(filesDir) != "files" {
+		return Item{}, fmt.Errorf("%s: %w", path, ErrNotTrashed)
+	}
+	item, err := readInfo(filepath.Dir(filesDir), filepath.Base(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Item{}, fmt.Errorf("%s: %w", path, ErrNotTrashed)
+		}
+		return Item{}, err
+	}
+	return item, nil
+}
+
+func readInfo(dir, name string) (Item, error) {
+	item := Item{Dir: dir, Name: name}
+	f, err := os.Open(item.infoPath())
+	if err != nil {
+		return Item{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			p, err := url.PathUnescape(value)
+			if err != nil {
+				return Item{}, fmt.Errorf("%s: bad Path: %w", item.infoPath(), err)
+			}
+			if !filepath.IsAbs(p) {
+				// Relative paths are relative to the mount holding
+				// $topdir/.Trash-$uid or $topdir/.Trash/$uid.
+				top := filepath.Dir(dir)
+				if filepath.Base(top) == ".Trash" {
+					top = filepath.Dir(top)
+				}
+				p = filepath.Join(top, p)
+			}
+			item.OriginalPath = filepath.Clean(p)
+		case "DeletionDate":
+			if t, err := time.ParseInLocation(dateFormat, value, time.Local); err == nil {
+				item.DeletedAt = t
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Item{}, err
+	}
+	if item.OriginalPath == "" {
+		return Item{}, fmt.Errorf("%s: missing Path", item.infoPath())
+	}
+	return item, nil
+}
+
+// Restore moves item back to dest, or to where it was trashed from if dest
+// is empty. It refuses to overwrite anything already there.
+func Restore(item Item, dest string) error {
+	if dest == "" {
+		dest = item.OriginalPath
+	}
+	if _, err := os.Lstat(item.Path()); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w (was the trash emptied?)", item.OriginalPath, ErrNotTrashed)
+		}
+		return err
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("cannot restore to %s: %w", dest, os.ErrExist)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(item.Path(), dest); err != nil {
+		return err
+	}
+	return os.Remove(item.infoPath())
+}
+
+// Remove deletes item for good.
+func Remove(item Item) error {
+	if err := os.RemoveAll(item.Path()); err != nil {
+		return err
+	}
+	if err := os.Remove(item.infoPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
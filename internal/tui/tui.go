@@ -121,9 +121,35 @@ func (m *model) updateViewport() {
 		case core.OpMove:
 			opType = "MOVE"
 			line = fmt.Sprintf("%s %s %s %s -> %s (folder)", cursor, checked, opType, srcName, filepath.Dir(relDest))
+		case core.OpCopy:
+			opType = "COPY"
+			line = fmt.Sprintf("%s %s %s %s -> %s (folder)", cursor, checked, opType, srcName, filepath.Dir(relDest))
+		case core.OpSymlink:
+			opType = "LINK"
+			line = fmt.Sprintf("%s %s %s %s -> %s (folder)", cursor, checked, opType, srcName, filepath.Dir(relDest))
+		case core.OpHardlink:
+			opType = "HARDLINK"
+			line = fmt.Sprintf("%s %s %s %s -> %s (folder)", cursor, checked, opType, srcName, filepath.Dir(relDest))
 		case core.OpDedupe:
 			opType = "DEDUPE"
 			line = fmt.Sprintf("%s %s %s %s -> duplicates (folder)", cursor, checked, opType, srcName)
+			if op.Keeper != "" {
+				keeper, err := filepath.Rel(m.dir, op.Keeper)
+				if err != nil {
+					keeper = op.Keeper
+				}
+				line += " [keeps " + keeper + "]"
+			}
+		case core.OpRelinkHard, core.OpRelinkReflink:
+			opType = "HARDLINK"
+			if op.OpType == core.OpRelinkReflink {
+				opType = "REFLINK"
+			}
+			keeper, err := filepath.Rel(m.dir, op.DestPath)
+			if err != nil {
+				keeper = op.DestPath
+			}
+			line = fmt.Sprintf("%s %s %s %s => %s (in place)", cursor, checked, opType, srcName, keeper)
 		case core.OpDelete:
 			opType = "DEL"
 			line = fmt.Sprintf("%s %s %s %s", cursor, checked, opType, srcName)
@@ -135,6 +161,10 @@ func (m *model) updateViewport() {
 			line = fmt.Sprintf("%s %s %s %s", cursor, checked, opType, srcName)
 		}
 
+		if note := op.ConflictNote(); note != "" {
+			line += " [" + note + "]"
+		}
+
 		if m.cursor == i {
 			sb.WriteString(selectedItemStyle.Render(line))
 		} else {
@@ -0,0 +1,173 @@
+package watch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+type inotify struct {
+	fd   int
+	file *os.File
+	ev   chan event
+	errs chan error
+	done chan struct{}
+
+	mu   sync.Mutex
+	dirs map[int32]string
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	n := &inotify{
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+		ev:   make(chan event, 256),
+		errs: make(chan error, 1),
+		done: make(chan struct{}),
+		dirs: make(map[int32]string),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotify) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, watchMask)
+	if err != nil {
+		return fmt.Errorf("watch %s: %w", dir, err)
+	}
+	n.mu.Lock()
+	n.dirs[int32(wd)] = dir
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *inotify) events() <-chan event { return n.ev }
+func (n *inotify) errors() <-chan error { return n.errs }
+
+func (n *inotify) close() error {
+	close(n.done)
+	return n.file.Close()
+}
+
+func (n *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				n.errs <- fmt.Errorf("inotify: %w", err)
+			}
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= count; {
+			wd := int32(binary.NativeEndian.Uint32(buf[off:]))
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			name := strings.TrimRight(string(buf[off+syscall.SizeofInotifyEvent:off+syscall.SizeofInotifyEvent+nameLen]), "\x00")
+			off += syscall.SizeofInotifyEvent + nameLen
+
+			for _, ev := range n.translate(wd, mask, name) {
+				select {
+				case n.ev <- ev:
+				case <-n.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (n *inotify) translate(wd int32, mask uint32, name string) []event {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Events were dropped; have every watched directory looked at again.
+		evs := make([]event, 0, len(n.dirs))
+		for _, dir := range n.dirs {
+			evs = append(evs, event{path: dir, isDir: true})
+		}
+		return evs
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.dirs, wd)
+		return nil
+	}
+	dir, ok := n.dirs[wd]
+	if !ok || name == "" {
+		return nil
+	}
+	return []event{{path: filepath.Join(dir, name), isDir: mask&syscall.IN_ISDIR != 0}}
+}
+
+// Lock takes the watch lock for root by holding an flock on
+// root/.sorta/watch.pid, so only one watcher runs per directory. Call the
+// returned func to release it.
+func Lock(root string) (func(), error) {
+	dir := filepath.Join(root, ".sorta")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "watch.pid")
+	f, err := lockFile(path, root)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		// Unlinking first means nobody can lock this file after we let
+		// go of it and still find it in place.
+		os.Remove(path)
+		f.Close()
+	}, nil
+}
+
+// lockFile opens and flocks path. A watcher that is shutting down removes
+// the file while it still holds the lock, so a lock taken on a file that
+// was opened just before is only good if path still names that file
+// afterwards; otherwise it is taken again on the new one.
+func lockFile(path, root string) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+			defer f.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				data, _ := os.ReadFile(path)
+				return nil, fmt.Errorf("%s is already being watched (pid %s)", root, strings.TrimSpace(string(data)))
+			}
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		locked, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if current, err := os.Stat(path); err == nil && os.SameFile(locked, current) {
+			return f, nil
+		}
+		f.Close()
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package watch
+
+func newNotifier() (notifier, error) {
+	return nil, ErrUnsupported
+}
+
+func Lock(root string) (func(), error) {
+	return nil, ErrUnsupported
+}
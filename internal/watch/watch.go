@@ -0,0 +1,164 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrUnsupported = errors.New("watch mode is only supported on Linux")
+
+// partialSuffixes mark files that browsers and download tools are still
+// writing. They are renamed once complete, which shows up as a new event.
+var partialSuffixes = []string{".crdownload", ".part", ".partial", ".download", ".opdownload", ".tmp"}
+
+type Options struct {
+	// Quiet is how long a file has to go without changes before it is
+	// handed over.
+	Quiet time.Duration
+	// MaxDepth limits how far below the root directories are watched.
+	MaxDepth int
+	// Skip reports paths that should be neither watched nor handed over.
+	Skip func(path string, isDir bool) bool
+}
+
+type event struct {
+	path  string
+	isDir bool
+}
+
+// notifier is the platform's file event source. A directory event means
+// "look at everything in here again".
+type notifier interface {
+	add(dir string) error
+	events() <-chan event
+	errors() <-chan error
+	close() error
+}
+
+// Watch calls handle with batches of files created or written below root,
+// once each has been quiet for opts.Quiet. It returns when ctx is done.
+func Watch(ctx context.Context, root string, opts Options, handle func(paths []string)) error {
+	n, err := newNotifier()
+	if err != nil {
+		return err
+	}
+	defer n.close()
+
+	w := &watcher{root: root, opts: opts, n: n}
+	if _, err := w.addTree(root); err != nil {
+		return err
+	}
+
+	pending := make(map[string]time.Time)
+	ticker := time.NewTicker(tickInterval(opts.Quiet))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err := <-n.errors():
+			return err
+
+		case ev := <-n.events():
+			if w.skip(ev.path, ev.isDir) {
+				continue
+			}
+			if !ev.isDir {
+				pending[ev.path] = time.Now()
+				continue
+			}
+			files, err := w.addTree(ev.path)
+			if err != nil {
+				continue
+			}
+			for _, f := range files {
+				pending[f] = time.Now()
+			}
+
+		case now := <-ticker.C:
+			var ready []string
+			for path, last := range pending {
+				if now.Sub(last) >= opts.Quiet {
+					ready = append(ready, path)
+					delete(pending, path)
+				}
+			}
+			if len(ready) > 0 {
+				sort.Strings(ready)
+				handle(ready)
+			}
+		}
+	}
+}
+
+type watcher struct {
+	root string
+	opts Options
+	n    notifier
+}
+
+func (w *watcher) skip(path string, isDir bool) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	if !isDir {
+		for _, suffix := range partialSuffixes {
+			if strings.HasSuffix(strings.ToLower(name), suffix) {
+				return true
+			}
+		}
+	}
+	return w.opts.Skip != nil && w.opts.Skip(path, isDir)
+}
+
+// addTree watches dir and the directories below it, returning the files
+// already in them.
+func (w *watcher) addTree(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if path != w.root && w.skip(path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			files = append(files, path)
+			return nil
+		}
+
+		rel, err := filepath.Rel(w.root, path)
+		if err == nil && rel != "." && w.opts.MaxDepth > 0 {
+			if strings.Count(rel, string(os.PathSeparator))+1 > w.opts.MaxDepth {
+				return filepath.SkipDir
+			}
+		}
+		if err := w.n.add(path); err != nil {
+			if path == dir {
+				return err
+			}
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return files, err
+}
+
+func tickInterval(quiet time.Duration) time.Duration {
+	return min(max(quiet/4, 50*time.Millisecond), time.Second)
+}
@@ -111,17 +111,40 @@ var DefaultConfig = `// Config file for 'sorta'
 // - Ignore rules are also loaded from .sortaignore, .sorta/ignore, and ~/.sorta/ignore.
 // - * as a keyword matches all filenames which don't contain the other keywords
 // - . as a foldernames means the root folder that you passed to sorta.
+// - @root = ~/Library sorts files into another directory instead (like --dest).
 // - To flatten the subfolder tree, use . = *
 // - Use regex for kewyords. Wrap your expression with: regex(). No quotes are required.
+// - Typed matchers: ext(pdf,docx) for exact extensions, glob(*.tar.*) for filename globs,
+//   path(Work/*) to match the path relative to the sorted folder, name(kw) for substrings.
+// - mime(image/*) and kind(video) match on the file's content instead of its name.
+// - Append i to a typed matcher for case-insensitive matching, e.g. ext(pdf)i.
+// - Conditions: size(>500MB), older(90d), newer(7d), mtime(<2024-01-01).
+//   Join matchers with & to require all of them, e.g. ext(iso) & size(>1GB).
 // - foldername can also be a relative folderpath. e.g. foo/bar/oof = rab creates a folder tree.
+// - foldername can contain date placeholders: {year}, {month}, {day}, {quarter}, {week} and more.
+//   Dates come from the file's mtime; add date=name to a rule to read them from the filename.
+// - Add conflict=suffix|skip|keep-newer|keep-larger|dedupe-if-identical to a rule to choose
+//   what happens when the destination already exists (default: suffix, e.g. "file (2).pdf").
+// - Add action=copy, action=link or action=hardlink to a rule to leave the file in place
+//   and put a copy or link in the folder instead of moving it.
 //
 // Example:
 //
-// Finance=invoice,bill,txt
+// Finance=invoice,bill,ext(txt)
+// Docs=ext(pdf,docx)i
 // Music=track,song
 // Study=notes,book
 // 2024-Papers=regex(^PAP.*2024$)
+// Archive/Old=older(90d)
+// Photos/{year}/{month}=ext(jpg,png), date=name
+// Tax=invoice, action=copy
 // others=*
 //
+// Keep duplicates under Photos rather than Downloads (sorta duplicates):
+// @keep = Photos, !Downloads
+//
+// Compare duplicates with SHA-256 instead of the faster default, xxh64:
+// @hash = sha256
+//
 // Important folder that sorta won't scan:
 // !my-secret-folder`